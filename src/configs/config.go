@@ -14,15 +14,49 @@ type TokenConfig struct {
 // Config 主配置结构
 type Config struct {
 	Server struct {
-		IP   string `yaml:"ip"`
-		Port int    `yaml:"port"`
-		Auth struct {
+		IP            string `yaml:"ip"`
+		Port          int    `yaml:"port"`
+		WebSocketPath string `yaml:"websocket_path"` // WebSocket接入路径
+		Unified       bool   `yaml:"unified"`        // WebSocket挂载到Web服务，与HTTP接口共用web.port
+		PublicURL     string `yaml:"public_url"`     // OTA下发的WebSocket地址，为空时根据请求计算
+		Auth          struct {
 			Enabled        bool          `yaml:"enabled"`
 			AllowedDevices []string      `yaml:"allowed_devices"`
 			Tokens         []TokenConfig `yaml:"tokens"`
+			SecretKey      string        `yaml:"secret_key"`
+			ExpireSeconds  int           `yaml:"expire_seconds"`
 		} `yaml:"auth"`
+		Activation struct {
+			Enabled    bool   `yaml:"enabled"`
+			CodeTTL    int    `yaml:"code_ttl_seconds"`
+			DataFile   string `yaml:"data_file"`
+			AdminToken string `yaml:"admin_token"`
+		} `yaml:"activation"`
+		Keepalive struct {
+			PingInterval int `yaml:"ping_interval"` // 心跳间隔(秒)，0表示不发送
+			ReadTimeout  int `yaml:"read_timeout"`  // 读取超时(秒)，0表示不限制
+		} `yaml:"keepalive"`
+		TLS struct {
+			Enabled    bool   `yaml:"enabled"`
+			CertFile   string `yaml:"cert_file"`
+			KeyFile    string `yaml:"key_file"`
+			AutoReload bool   `yaml:"auto_reload"` // 证书文件更新后自动重新加载
+		} `yaml:"tls"`
+		AllowedOrigins []string `yaml:"allowed_origins"` // 允许连接WebSocket的网页来源
 	} `yaml:"server"`
 
+	MQTT struct {
+		Enabled        bool   `yaml:"enabled"`
+		IP             string `yaml:"ip"`
+		Port           int    `yaml:"port"`
+		PublicEndpoint string `yaml:"public_endpoint"`
+		UDP            struct {
+			IP       string `yaml:"ip"`
+			Port     int    `yaml:"port"`
+			PublicIP string `yaml:"public_ip"`
+		} `yaml:"udp"`
+	} `yaml:"mqtt"`
+
 	Log struct {
 		LogFormat string `yaml:"log_format"`
 		LogLevel  string `yaml:"log_level"`
@@ -36,17 +70,95 @@ type Config struct {
 		StaticDir string `yaml:"static_dir"`
 	} `yaml:"web"`
 
+	Idle struct {
+		Timeout    int    `yaml:"timeout"`     // 无交互超过该秒数后提醒用户，0表示不启用
+		CloseAfter int    `yaml:"close_after"` // 提醒后仍无交互，再过该秒数告别并断开
+		Prompt     string `yaml:"prompt"`      // 提醒语，为空则直接告别
+	} `yaml:"idle"`
+
+	Wakeup struct {
+		Words       []string `yaml:"words"`        // 唤醒词
+		QuickReply  bool     `yaml:"quick_reply"`  // 唤醒时直接播放问候语，不请求LLM
+		Replies     []string `yaml:"replies"`      // 问候语，启动时预先合成
+		SaveHistory bool     `yaml:"save_history"` // 是否把唤醒词和问候语写入对话历史
+		CacheDir    string   `yaml:"cache_dir"`    // 问候语音频缓存目录
+	} `yaml:"wakeup"`
+
+	BargeIn struct {
+		Enabled        bool     `yaml:"enabled"`         // 实时模式下是否允许插话打断
+		MinEnergy      float64  `yaml:"min_energy"`      // 插话的最低RMS能量
+		MinDuration    int      `yaml:"min_duration_ms"` // 插话需持续的时长(毫秒)
+		EchoGate       bool     `yaml:"echo_gate"`       // 识别结果与正在播放的文本相符时视为回声
+		InterruptWords []string `yaml:"interrupt_words"` // 打断词，识别到后立即停止播放
+	} `yaml:"barge_in"`
+
 	DeleteAudio      bool `yaml:"delete_audio"`
 	UsePrivateConfig bool `yaml:"use_private_config"`
 
 	SelectedModule map[string]string `yaml:"selected_module"`
 
+	Agents struct {
+		Default  string                 `yaml:"default"`  // 默认智能体，设备未指定时使用
+		Profiles map[string]AgentConfig `yaml:"profiles"` // 智能体列表
+		Devices  map[string]string      `yaml:"devices"`  // 设备ID到智能体名称的映射
+	} `yaml:"agents"`
+
+	Devices map[string]DeviceConfig `yaml:"devices"` // 设备信息，用于系统提示词模板
+
+	IPLocation struct {
+		Enabled bool   `yaml:"enabled"` // 根据客户端IP查询所在地区和时区
+		URL     string `yaml:"url"`     // 查询接口，{ip}替换为客户端IP
+	} `yaml:"ip_location"`
+
+	Pool struct {
+		MinSize int `yaml:"min_size"`
+		MaxSize int `yaml:"max_size"`
+	} `yaml:"pool"`
+
+	Tools struct {
+		Enabled []string `yaml:"enabled"`
+	} `yaml:"tools"`
+
+	MCP struct {
+		Servers map[string]MCPServerConfig `yaml:"servers"`
+	} `yaml:"mcp"`
+
 	VAD map[string]VADConfig `yaml:"VAD"`
 	ASR map[string]ASRConfig `yaml:"ASR"`
 	TTS map[string]TTSConfig `yaml:"TTS"`
 	LLM map[string]LLMConfig `yaml:"LLM"`
 
-	CMDExit []string `yaml:"CMD_exit"`
+	CMDExit      []string `yaml:"CMD_exit"`
+	ExitFarewell string   `yaml:"exit_farewell"` // 退出指令的告别语
+}
+
+// AgentConfig 智能体配置，定义助手的人设以及使用的模块和工具
+type AgentConfig struct {
+	Name     string   `yaml:"name"`     // 助手名称
+	Prompt   string   `yaml:"prompt"`   // 系统提示词
+	Language string   `yaml:"language"` // 回复使用的语言，为空时不限制
+	Voice    string   `yaml:"voice"`    // 音色，为空时使用TTS配置中的音色
+	Tools    []string `yaml:"tools"`    // 启用的工具，未配置时使用tools.enabled
+	LLM      string   `yaml:"llm"`      // LLM配置名，为空时使用selected_module
+	TTS      string   `yaml:"tts"`      // TTS配置名，为空时使用selected_module
+}
+
+// DeviceConfig 设备信息配置，未配置的项根据激活信息或客户端IP推断
+type DeviceConfig struct {
+	Name     string `yaml:"name"`     // 设备名称，为空时使用激活时填写的别名
+	Nickname string `yaml:"nickname"` // 用户昵称
+	Timezone string `yaml:"timezone"` // 设备时区，如Asia/Shanghai
+	Location string `yaml:"location"` // 设备所在地区
+}
+
+// MCPServerConfig 外部MCP服务配置，command和url二选一
+type MCPServerConfig struct {
+	Command  string            `yaml:"command"` // stdio方式启动的命令
+	Args     []string          `yaml:"args"`
+	Env      map[string]string `yaml:"env"`
+	URL      string            `yaml:"url"` // SSE服务地址
+	Headers  map[string]string `yaml:"headers"`
+	Disabled bool              `yaml:"disabled"`
 }
 
 // VADConfig VAD配置结构
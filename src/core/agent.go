@@ -0,0 +1,94 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/tools"
+)
+
+// resolveAgent 返回设备使用的智能体名称和配置
+// 设备未单独指定时使用默认智能体，未配置任何智能体时返回空配置，各项均使用全局配置
+func resolveAgent(config *configs.Config, deviceID string) (string, configs.AgentConfig) {
+	name := config.Agents.Devices[deviceID]
+	if name == "" {
+		name = config.Agents.Default
+	}
+	return name, config.Agents.Profiles[name]
+}
+
+// validateAgents 检查智能体配置，引用不存在的智能体、模块或工具时返回错误
+func validateAgents(config *configs.Config) error {
+	agents := config.Agents
+	if agents.Default != "" {
+		if _, ok := agents.Profiles[agents.Default]; !ok {
+			return fmt.Errorf("找不到默认智能体: %s", agents.Default)
+		}
+	}
+	for deviceID, name := range agents.Devices {
+		if _, ok := agents.Profiles[name]; !ok {
+			return fmt.Errorf("设备%s指定的智能体不存在: %s", deviceID, name)
+		}
+	}
+	for name, agent := range agents.Profiles {
+		if agent.LLM != "" {
+			if _, ok := config.LLM[agent.LLM]; !ok {
+				return fmt.Errorf("智能体%s使用的LLM配置不存在: %s", name, agent.LLM)
+			}
+		}
+		if agent.TTS != "" {
+			if _, ok := config.TTS[agent.TTS]; !ok {
+				return fmt.Errorf("智能体%s使用的TTS配置不存在: %s", name, agent.TTS)
+			}
+		}
+		if _, err := tools.Resolve(agent.Tools); err != nil {
+			return fmt.Errorf("智能体%s: %v", name, err)
+		}
+		if _, err := parsePromptTemplate(systemPrompt(agent)); err != nil {
+			return fmt.Errorf("智能体%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// systemPrompt 根据智能体配置生成系统提示词模板，名称和语言附加在提示词之后
+func systemPrompt(agent configs.AgentConfig) string {
+	var parts []string
+	if prompt := strings.TrimSpace(agent.Prompt); prompt != "" {
+		parts = append(parts, prompt)
+	}
+	if agent.Name != "" {
+		parts = append(parts, fmt.Sprintf("你的名字是%s。", agent.Name))
+	}
+	if agent.Language != "" {
+		parts = append(parts, fmt.Sprintf("请使用%s回复用户。", agent.Language))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// applyAgent 为会话加载智能体：注册启用的工具，并把渲染后的系统提示词作为对话的第一条消息
+func (h *ConnectionHandler) applyAgent(name string, agent configs.AgentConfig) {
+	h.agentName = name
+	h.agent = agent
+
+	enabled := agent.Tools
+	if enabled == nil {
+		enabled = h.config.Tools.Enabled
+	}
+	h.registerTools(enabled)
+
+	if prompt := systemPrompt(agent); prompt != "" {
+		tmpl, err := parsePromptTemplate(prompt)
+		if err != nil {
+			// 启动时已检查过模板，这里只做兜底
+			h.logger.Error(fmt.Sprintf("智能体%s: %v", name, err))
+		} else {
+			h.promptTmpl = tmpl
+			h.refreshSystemPrompt()
+		}
+	}
+	if name != "" {
+		h.logger.Info(fmt.Sprintf("会话使用智能体: %s", name))
+	}
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"testing"
+
+	"xiaozhi-server-go/src/configs"
+)
+
+func newAgentTestConfig() *configs.Config {
+	config := &configs.Config{
+		LLM: map[string]configs.LLMConfig{"qwen": {}},
+		TTS: map[string]configs.TTSConfig{"edge": {}},
+	}
+	config.Agents.Default = "assistant"
+	config.Agents.Profiles = map[string]configs.AgentConfig{
+		"assistant": {Name: "小智"},
+		"teacher":   {Name: "老师", LLM: "qwen", TTS: "edge", Tools: []string{"get_current_time"}},
+	}
+	config.Agents.Devices = map[string]string{"aa:bb:cc:dd:ee:ff": "teacher"}
+	return config
+}
+
+func TestResolveAgent(t *testing.T) {
+	config := newAgentTestConfig()
+	tests := []struct {
+		deviceID string
+		wantName string
+	}{
+		{"aa:bb:cc:dd:ee:ff", "teacher"},
+		{"11:22:33:44:55:66", "assistant"},
+		{"", "assistant"},
+	}
+	for _, tt := range tests {
+		name, agent := resolveAgent(config, tt.deviceID)
+		if name != tt.wantName || agent.Name != config.Agents.Profiles[tt.wantName].Name {
+			t.Errorf("resolveAgent(%q) = %q, %+v, want %q", tt.deviceID, name, agent, tt.wantName)
+		}
+	}
+
+	name, agent := resolveAgent(&configs.Config{}, "aa:bb:cc:dd:ee:ff")
+	if name != "" || agent.Name != "" {
+		t.Errorf("resolveAgent() without agents = %q, %+v, want empty", name, agent)
+	}
+}
+
+func TestValidateAgents(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(config *configs.Config)
+		wantErr bool
+	}{
+		{"有效配置", func(config *configs.Config) {}, false},
+		{"未配置智能体", func(config *configs.Config) { config.Agents = (&configs.Config{}).Agents }, false},
+		{"默认智能体不存在", func(config *configs.Config) { config.Agents.Default = "unknown" }, true},
+		{"设备指定的智能体不存在", func(config *configs.Config) { config.Agents.Devices["device"] = "unknown" }, true},
+		{"LLM配置不存在", func(config *configs.Config) {
+			config.Agents.Profiles["assistant"] = configs.AgentConfig{LLM: "unknown"}
+		}, true},
+		{"TTS配置不存在", func(config *configs.Config) {
+			config.Agents.Profiles["assistant"] = configs.AgentConfig{TTS: "unknown"}
+		}, true},
+		{"工具不存在", func(config *configs.Config) {
+			config.Agents.Profiles["assistant"] = configs.AgentConfig{Tools: []string{"unknown"}}
+		}, true},
+		{"提示词模板错误", func(config *configs.Config) {
+			config.Agents.Profiles["assistant"] = configs.AgentConfig{Prompt: "今天是{{.Date"}
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newAgentTestConfig()
+			tt.modify(config)
+			if err := validateAgents(config); (err != nil) != tt.wantErr {
+				t.Errorf("validateAgents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSystemPrompt(t *testing.T) {
+	tests := []struct {
+		name  string
+		agent configs.AgentConfig
+		want  string
+	}{
+		{"空配置", configs.AgentConfig{}, ""},
+		{"只有提示词", configs.AgentConfig{Prompt: "  你是一个助手  "}, "你是一个助手"},
+		{"完整配置", configs.AgentConfig{Prompt: "你是一个助手", Name: "小智", Language: "英语"},
+			"你是一个助手\n你的名字是小智。\n请使用英语回复用户。"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := systemPrompt(tt.agent); got != tt.want {
+				t.Errorf("systemPrompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,395 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const (
+	// audioPrebufferFrames 每句开始时不等待直接发送的帧数，作为设备端的播放缓冲，吸收网络抖动
+	audioPrebufferFrames = 3
+	// ttsMaxConcurrency 每个会话同时合成的最大句子数
+	ttsMaxConcurrency = 3
+)
+
+// errAudioInterrupted 播放被服务端打断或连接已关闭
+var errAudioInterrupted = errors.New("音频播放被打断")
+
+// audioTask 待下发的一句音频，ready关闭后合成结果可用
+// filepath和stream均为空表示合成失败；ctx为所属的一轮对话，取消时任务随之取消
+type audioTask struct {
+	ctx         context.Context
+	turn        *chatTurn // 所属的一轮对话，不属于任何一轮时为nil
+	text        string
+	textIndex   int
+	ready       chan struct{}
+	stopWatch   func() bool // 停止监听ctx
+	releaseOnce sync.Once
+
+	filepath  string
+	stream    *providers.AudioStream // 流式合成的音频，与filepath二选一
+	cancelled bool
+	mu        sync.Mutex
+}
+
+func newAudioTask(ctx context.Context, text string, textIndex int) *audioTask {
+	task := &audioTask{
+		ctx:       ctx,
+		turn:      turnFromContext(ctx),
+		text:      text,
+		textIndex: textIndex,
+		ready:     make(chan struct{}),
+	}
+	if task.turn != nil {
+		task.turn.addAudio()
+	}
+	task.stopWatch = context.AfterFunc(ctx, task.cancel)
+	return task
+}
+
+// newAudioFileTask 创建已有音频文件的任务，无需合成
+func newAudioFileTask(ctx context.Context, filepath string, text string, textIndex int) *audioTask {
+	task := newAudioTask(ctx, text, textIndex)
+	task.finish(filepath, nil)
+	return task
+}
+
+// finish 设置合成结果，任务已取消时直接关闭音频流
+func (t *audioTask) finish(filepath string, stream *providers.AudioStream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cancelled {
+		if stream != nil {
+			stream.Close()
+		}
+	} else {
+		t.filepath, t.stream = filepath, stream
+	}
+	close(t.ready)
+}
+
+// cancel 取消任务，已得到的音频流立即关闭以中止合成
+func (t *audioTask) cancel() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cancelled = true
+	if t.stream != nil {
+		t.stream.Close()
+		t.stream = nil
+	}
+}
+
+// release 任务下发结束或被丢弃后调用，不再随ctx取消，可重复调用
+// 已播放的文本需在调用前记录，开始新一轮时据此改写被打断的回复
+func (t *audioTask) release() {
+	t.releaseOnce.Do(func() {
+		t.stopWatch()
+		if t.turn != nil {
+			t.turn.doneAudio()
+		}
+	})
+}
+
+// result 返回合成结果，需在ready关闭后调用
+func (t *audioTask) result() (string, *providers.AudioStream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.filepath, t.stream
+}
+
+// prefetchStream 在后台持续读取音频流并缓存
+// 流式合成的音频通过同步管道传递，不读取时合成会停住，预先读取后播放前面的句子时后面的句子也在合成
+// 合成结束或流被关闭后释放合成并发名额，同时打开的TTS连接不超过ttsMaxConcurrency
+type prefetchStream struct {
+	src     io.ReadCloser
+	release func()
+	buf     bytes.Buffer
+	err     error // 后台读取结束的原因，正常结束为io.EOF
+	closed  bool
+	mu      sync.Mutex
+	cond    *sync.Cond
+}
+
+// newPrefetchStream 包装音频流并开始后台读取，release在合成结束后调用一次
+func newPrefetchStream(stream *providers.AudioStream, release func()) *providers.AudioStream {
+	p := &prefetchStream{src: stream.ReadCloser, release: release}
+	p.cond = sync.NewCond(&p.mu)
+	go p.fill()
+	return &providers.AudioStream{ReadCloser: p, SampleRate: stream.SampleRate}
+}
+
+// fill 读取音频流直到结束或被关闭
+func (p *prefetchStream) fill() {
+	defer p.release()
+	chunk := make([]byte, 4096)
+	for {
+		n, err := p.src.Read(chunk)
+		p.mu.Lock()
+		if n > 0 && !p.closed {
+			p.buf.Write(chunk[:n])
+		}
+		if err != nil {
+			p.err = err
+		}
+		done := p.err != nil || p.closed
+		p.cond.Broadcast()
+		p.mu.Unlock()
+		if done {
+			p.src.Close()
+			return
+		}
+	}
+}
+
+func (p *prefetchStream) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.buf.Len() == 0 && p.err == nil && !p.closed {
+		p.cond.Wait()
+	}
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if p.buf.Len() > 0 {
+		return p.buf.Read(b)
+	}
+	return 0, p.err
+}
+
+// Close 丢弃已缓存的音频并中止合成
+func (p *prefetchStream) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.buf.Reset()
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	return p.src.Close()
+}
+
+// playbackProgress 当前句子的播放进度
+type playbackProgress struct {
+	Text      string
+	TextIndex int
+	Position  time.Duration // 设备已播放的时长
+	Sent      time.Duration // 已下发的音频时长
+}
+
+// audioFrameSource 逐帧提供下行音频，没有更多数据时返回io.EOF
+type audioFrameSource func() ([]byte, error)
+
+// sliceFrameSource 依次提供已编码好的音频帧
+func sliceFrameSource(frames [][]byte) audioFrameSource {
+	i := 0
+	return func() ([]byte, error) {
+		if i >= len(frames) {
+			return nil, io.EOF
+		}
+		i++
+		return frames[i-1], nil
+	}
+}
+
+// newStreamFrameSource 从PCM音频流中按帧时长读取，下行格式为opus时逐帧编码
+// 音频流采样率与hello中下发给设备的采样率不同时先重采样
+// 返回的关闭函数用于释放编码器
+func (h *ConnectionHandler) newStreamFrameSource(stream *providers.AudioStream, frameDuration time.Duration) (audioFrameSource, func(), error) {
+	if stream.SampleRate <= 0 {
+		return nil, nil, fmt.Errorf("无效的音频流采样率: %d", stream.SampleRate)
+	}
+	var pcm io.Reader = stream
+	sampleRate := stream.SampleRate
+	if h.serverAudioSampleRate > 0 && sampleRate != h.serverAudioSampleRate {
+		pcm = utils.NewPCMResampler(stream, sampleRate, h.serverAudioSampleRate)
+		sampleRate = h.serverAudioSampleRate
+	}
+
+	frameMs := int(frameDuration / time.Millisecond)
+	frameSize := sampleRate * frameMs / 1000 * 2
+	if frameSize <= 0 {
+		return nil, nil, fmt.Errorf("无效的音频帧时长: %v", frameDuration)
+	}
+
+	var encoder *utils.OpusEncoder
+	if h.serverAudioFormat == "opus" {
+		var err error
+		if encoder, err = utils.NewOpusEncoder(sampleRate, 1, frameMs); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	buf := make([]byte, frameSize)
+	source := func() ([]byte, error) {
+		n, err := io.ReadFull(pcm, buf)
+		switch err {
+		case nil:
+		case io.ErrUnexpectedEOF:
+			// 最后一帧不足一帧时长，补齐静音
+			for i := n; i < len(buf); i++ {
+				buf[i] = 0
+			}
+		default:
+			return nil, err
+		}
+
+		if encoder == nil {
+			frame := make([]byte, len(buf))
+			copy(frame, buf)
+			return frame, nil
+		}
+		return encoder.Encode(buf)
+	}
+	closeSource := func() {
+		if encoder != nil {
+			encoder.Close()
+		}
+	}
+	return source, closeSource, nil
+}
+
+// sendAudioFrames 按帧时长匀速下发音频帧
+// 前audioPrebufferFrames帧立即发送，之后第i帧在设备开始播放第i-audioPrebufferFrames帧时发送，
+// 设备缓冲始终保持在几帧以内；每帧发送前检查服务端打断，打断延迟不超过一帧
+// 流式合成慢于播放导致设备缓冲耗尽时，从当前时间重新计算发送节奏
+// 返回设备已播放的时长，被打断或ctx取消时返回errAudioInterrupted
+func (h *ConnectionHandler) sendAudioFrames(ctx context.Context, next audioFrameSource, frameDuration time.Duration, text string, textIndex int) (time.Duration, error) {
+	start := time.Now()
+	sent := 0
+	h.setPlaybackProgress(playbackProgress{Text: text, TextIndex: textIndex})
+
+	for {
+		frame, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return h.updatePlaybackPosition(start, sent, frameDuration), err
+		}
+
+		if now := time.Now(); now.After(start.Add(time.Duration(sent) * frameDuration)) {
+			start = now.Add(-time.Duration(sent) * frameDuration)
+		}
+		if sent >= audioPrebufferFrames {
+			if !h.sleepUntil(ctx, start.Add(time.Duration(sent-audioPrebufferFrames)*frameDuration)) {
+				return h.updatePlaybackPosition(start, sent, frameDuration), errAudioInterrupted
+			}
+		}
+		if atomic.LoadInt32(&h.serverVoiceStop) == 1 || ctx.Err() != nil {
+			return h.updatePlaybackPosition(start, sent, frameDuration), errAudioInterrupted
+		}
+		if err := h.conn.WriteMessage(2, frame); err != nil {
+			return h.updatePlaybackPosition(start, sent, frameDuration), err
+		}
+		sent++
+		h.updatePlaybackPosition(start, sent, frameDuration)
+	}
+
+	// 等待设备播放完缓冲中的剩余帧
+	if !h.sleepUntil(ctx, start.Add(time.Duration(sent)*frameDuration)) {
+		return h.updatePlaybackPosition(start, sent, frameDuration), errAudioInterrupted
+	}
+	return h.updatePlaybackPosition(start, sent, frameDuration), nil
+}
+
+// sleepUntil 等待到指定时间，连接关闭、ctx取消或服务端打断时返回false
+func (h *ConnectionHandler) sleepUntil(ctx context.Context, t time.Time) bool {
+	if d := time.Until(t); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-h.stopChan:
+			return false
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+		}
+	}
+	return atomic.LoadInt32(&h.serverVoiceStop) == 0 && ctx.Err() == nil
+}
+
+// updatePlaybackPosition 根据已发送帧数和经过的时间估算设备播放位置
+// 设备收到第一帧即开始播放，播放位置不会超过已发送的音频时长
+func (h *ConnectionHandler) updatePlaybackPosition(start time.Time, sentFrames int, frameDuration time.Duration) time.Duration {
+	position := time.Since(start)
+	if sent := time.Duration(sentFrames) * frameDuration; position > sent {
+		position = sent
+	}
+
+	h.playbackMu.Lock()
+	h.playback.Position = position
+	h.playback.Sent = time.Duration(sentFrames) * frameDuration
+	h.playbackMu.Unlock()
+	return position
+}
+
+func (h *ConnectionHandler) setPlaybackProgress(progress playbackProgress) {
+	h.playbackMu.Lock()
+	h.playback = progress
+	h.playbackMu.Unlock()
+}
+
+// currentPlayback 返回当前句子的播放进度
+func (h *ConnectionHandler) currentPlayback() playbackProgress {
+	h.playbackMu.Lock()
+	defer h.playbackMu.Unlock()
+	return h.playback
+}
+
+// heardText 按播放时长占整句时长的比例估算用户已听到的文本
+func heardText(text string, played, total time.Duration) string {
+	if total <= 0 || played <= 0 {
+		return ""
+	}
+	if played >= total {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:int(float64(len(runes))*float64(played)/float64(total))])
+}
+
+// joinFrames 拼接音频数据块
+func joinFrames(chunks [][]byte) []byte {
+	if len(chunks) == 1 {
+		return chunks[0]
+	}
+	var data []byte
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return data
+}
+
+// splitPCMFrames 将整段PCM数据按帧时长切分，duration为整段音频的时长(秒)
+func splitPCMFrames(pcm []byte, duration float64, frameDuration time.Duration) [][]byte {
+	if len(pcm) == 0 || duration <= 0 {
+		return nil
+	}
+	// 16位采样，每帧字节数需为偶数
+	frameSize := int(float64(len(pcm)) / duration * frameDuration.Seconds())
+	frameSize -= frameSize % 2
+	if frameSize <= 0 {
+		return [][]byte{pcm}
+	}
+
+	frames := make([][]byte, 0, len(pcm)/frameSize+1)
+	for offset := 0; offset < len(pcm); offset += frameSize {
+		end := offset + frameSize
+		if end > len(pcm) {
+			end = len(pcm)
+		}
+		frames = append(frames, pcm[offset:end])
+	}
+	return frames
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"xiaozhi-server-go/src/core/providers"
+)
+
+func TestStreamFrameSourceResamples(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRate int
+		wantFrames int
+	}{
+		{"与设备采样率相同", 24000, 5},
+		{"16kHz", 16000, 5},
+		{"22.05kHz", 22050, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &ConnectionHandler{serverAudioFormat: "pcm", serverAudioSampleRate: 24000}
+			// 300ms的PCM音频，按60ms一帧应得到5帧
+			pcm := make([]byte, tt.sampleRate*300/1000*2)
+			stream := &providers.AudioStream{ReadCloser: io.NopCloser(bytes.NewReader(pcm)), SampleRate: tt.sampleRate}
+
+			next, closeSource, err := h.newStreamFrameSource(stream, 60*time.Millisecond)
+			if err != nil {
+				t.Fatalf("newStreamFrameSource() error = %v", err)
+			}
+			defer closeSource()
+
+			frames := 0
+			for {
+				frame, err := next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("next() error = %v", err)
+				}
+				if want := 24000 * 60 / 1000 * 2; len(frame) != want {
+					t.Fatalf("frame size = %d, want %d", len(frame), want)
+				}
+				frames++
+			}
+			if frames != tt.wantFrames {
+				t.Errorf("frames = %d, want %d", frames, tt.wantFrames)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+)
+
+var (
+	// ErrMissingDeviceID 缺少设备ID
+	ErrMissingDeviceID = errors.New("缺少Device-Id")
+	// ErrMissingToken 缺少认证token
+	ErrMissingToken = errors.New("缺少认证token")
+	// ErrInvalidToken token无效
+	ErrInvalidToken = errors.New("无效的token")
+	// ErrTokenExpired token已过期
+	ErrTokenExpired = errors.New("token已过期")
+	// ErrDeviceMismatch 签名token与设备不匹配
+	ErrDeviceMismatch = errors.New("token与设备不匹配")
+)
+
+// AuthManager 握手认证管理器
+// 白名单中的设备无需token；其他设备需要携带配置中的静态token，
+// 或者由secret_key签名、带过期时间并绑定设备ID的token
+type AuthManager struct {
+	enabled        bool
+	tokens         map[string]struct{}
+	allowedDevices map[string]struct{}
+	secretKey      []byte
+	expire         time.Duration
+}
+
+// NewAuthManager 根据配置创建认证管理器
+func NewAuthManager(config *configs.Config) *AuthManager {
+	authCfg := config.Server.Auth
+	am := &AuthManager{
+		enabled:        authCfg.Enabled,
+		tokens:         make(map[string]struct{}),
+		allowedDevices: make(map[string]struct{}),
+		secretKey:      []byte(authCfg.SecretKey),
+		expire:         time.Duration(authCfg.ExpireSeconds) * time.Second,
+	}
+	for _, t := range authCfg.Tokens {
+		if t.Token != "" {
+			am.tokens[t.Token] = struct{}{}
+		}
+	}
+	for _, device := range authCfg.AllowedDevices {
+		am.allowedDevices[device] = struct{}{}
+	}
+	if am.expire <= 0 {
+		am.expire = 30 * 24 * time.Hour
+	}
+	return am
+}
+
+// Enabled 是否启用认证
+func (am *AuthManager) Enabled() bool {
+	return am.enabled
+}
+
+// Authenticate 校验握手请求，token为去掉Bearer前缀后的值
+func (am *AuthManager) Authenticate(token, deviceID string) error {
+	if !am.enabled {
+		return nil
+	}
+	if deviceID == "" {
+		return ErrMissingDeviceID
+	}
+	if _, ok := am.allowedDevices[deviceID]; ok {
+		return nil
+	}
+	return am.CheckToken(token, deviceID)
+}
+
+// CheckToken 校验token对设备是否有效，不考虑设备白名单
+func (am *AuthManager) CheckToken(token, deviceID string) error {
+	if deviceID == "" {
+		return ErrMissingDeviceID
+	}
+	if token == "" {
+		return ErrMissingToken
+	}
+	if _, ok := am.tokens[token]; ok {
+		return nil
+	}
+
+	tokenDevice, err := am.VerifyToken(token)
+	if err != nil {
+		return err
+	}
+	if tokenDevice != deviceID {
+		return ErrDeviceMismatch
+	}
+	return nil
+}
+
+// GenerateToken 为设备签发带过期时间的token
+func (am *AuthManager) GenerateToken(deviceID string) (string, error) {
+	if len(am.secretKey) == 0 {
+		return "", fmt.Errorf("未配置secret_key，无法签发token")
+	}
+	if deviceID == "" {
+		return "", ErrMissingDeviceID
+	}
+
+	payload := fmt.Sprintf("%s|%d", deviceID, time.Now().Add(am.expire).Unix())
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(am.sign(payload)), nil
+}
+
+// VerifyToken 校验签名token，返回token绑定的设备ID
+func (am *AuthManager) VerifyToken(token string) (string, error) {
+	if len(am.secretKey) == 0 {
+		return "", ErrInvalidToken
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", ErrInvalidToken
+	}
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	payload := string(payloadBytes)
+	if !hmac.Equal(signature, am.sign(payload)) {
+		return "", ErrInvalidToken
+	}
+
+	sep := strings.LastIndex(payload, "|")
+	if sep <= 0 {
+		return "", ErrInvalidToken
+	}
+	expiresAt, err := strconv.ParseInt(payload[sep+1:], 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if time.Now().Unix() > expiresAt {
+		return "", ErrTokenExpired
+	}
+	return payload[:sep], nil
+}
+
+// sign 计算HMAC-SHA256签名
+func (am *AuthManager) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, am.secretKey)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// ParseBearerToken 从Authorization头中解析token
+func ParseBearerToken(header string) string {
+	header = strings.TrimSpace(header)
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return header
+}
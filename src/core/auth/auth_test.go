@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+)
+
+func newTestManager(secretKey string) *AuthManager {
+	config := &configs.Config{}
+	config.Server.Auth.Enabled = true
+	config.Server.Auth.SecretKey = secretKey
+	config.Server.Auth.Tokens = []configs.TokenConfig{{Token: "static-token"}}
+	config.Server.Auth.AllowedDevices = []string{"allowed-device"}
+	return NewAuthManager(config)
+}
+
+// signedToken 使用指定的过期时间构造签名token
+func signedToken(am *AuthManager, deviceID string, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%s|%d", deviceID, expiresAt.Unix())
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(am.sign(payload))
+}
+
+func TestGenerateAndVerifyToken(t *testing.T) {
+	am := newTestManager("secret")
+	token, err := am.GenerateToken("aa:bb:cc:dd:ee:ff")
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	deviceID, err := am.VerifyToken(token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error = %v", err)
+	}
+	if deviceID != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("VerifyToken() = %q, want %q", deviceID, "aa:bb:cc:dd:ee:ff")
+	}
+}
+
+func TestGenerateTokenErrors(t *testing.T) {
+	if _, err := newTestManager("").GenerateToken("device"); err == nil {
+		t.Error("GenerateToken() without secret_key should fail")
+	}
+	if _, err := newTestManager("secret").GenerateToken(""); err != ErrMissingDeviceID {
+		t.Errorf("GenerateToken(\"\") error = %v, want %v", err, ErrMissingDeviceID)
+	}
+}
+
+func TestVerifyTokenInvalid(t *testing.T) {
+	am := newTestManager("secret")
+	valid, _ := am.GenerateToken("device")
+	other, _ := newTestManager("other-secret").GenerateToken("device")
+
+	tests := []struct {
+		name  string
+		am    *AuthManager
+		token string
+		want  error
+	}{
+		{"空token", am, "", ErrInvalidToken},
+		{"缺少签名", am, "ZGV2aWNl", ErrInvalidToken},
+		{"非法base64", am, "!!!.!!!", ErrInvalidToken},
+		{"其他密钥签名", am, other, ErrInvalidToken},
+		{"篡改签名", am, valid + "x", ErrInvalidToken},
+		{"缺少过期时间", am, base64.RawURLEncoding.EncodeToString([]byte("device")) + "." +
+			base64.RawURLEncoding.EncodeToString(am.sign("device")), ErrInvalidToken},
+		{"已过期", am, signedToken(am, "device", time.Now().Add(-time.Minute)), ErrTokenExpired},
+		{"未配置secret_key", newTestManager(""), valid, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.am.VerifyToken(tt.token); err != tt.want {
+				t.Errorf("VerifyToken() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	am := newTestManager("secret")
+	deviceToken, _ := am.GenerateToken("device")
+
+	tests := []struct {
+		name     string
+		token    string
+		deviceID string
+		want     error
+	}{
+		{"签名token", deviceToken, "device", nil},
+		{"静态token", "static-token", "device", nil},
+		{"白名单设备无需token", "", "allowed-device", nil},
+		{"缺少设备ID", deviceToken, "", ErrMissingDeviceID},
+		{"缺少token", "", "device", ErrMissingToken},
+		{"设备不匹配", deviceToken, "other-device", ErrDeviceMismatch},
+		{"无效token", "unknown", "device", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := am.Authenticate(tt.token, tt.deviceID); err != tt.want {
+				t.Errorf("Authenticate() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateDisabled(t *testing.T) {
+	am := NewAuthManager(&configs.Config{})
+	if err := am.Authenticate("", ""); err != nil {
+		t.Errorf("Authenticate() with auth disabled error = %v, want nil", err)
+	}
+}
+
+func TestParseBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"Bearer abc", "abc"},
+		{"bearer abc", "abc"},
+		{"  Bearer  abc  ", "abc"},
+		{"abc", "abc"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ParseBearerToken(tt.header); got != tt.want {
+			t.Errorf("ParseBearerToken(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCheckTokenIgnoresAllowedDevices(t *testing.T) {
+	am := newTestManager("secret")
+	if err := am.CheckToken("anything", "allowed-device"); err != ErrInvalidToken {
+		t.Errorf("CheckToken() for allowed device error = %v, want %v", err, ErrInvalidToken)
+	}
+	if err := am.CheckToken("static-token", "allowed-device"); err != nil {
+		t.Errorf("CheckToken() with static token error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultClientSampleRate 客户端未上报采样率时使用的默认值
+const defaultClientSampleRate = 16000
+
+// isServerSpeaking 服务端是否正在下发语音，从tts start到tts stop之间为true
+func (h *ConnectionHandler) isServerSpeaking() bool {
+	return atomic.LoadInt32(&h.serverSpeaking) == 1
+}
+
+// trackBargeIn 实时模式下根据本地VAD和音频能量判断用户是否在插话
+// 服务端播放期间VAD判定说话且能量不低于min_energy的音频累计达到min_duration_ms时确认插话
+// ASR的最终结果通常在VAD判定说话结束之后才到达，确认后不随说话结束清除，
+// 直到识别结果被处理或本轮播放结束
+func (h *ConnectionHandler) trackBargeIn(pcm []byte) {
+	if h.clientListenMode != "realtime" || h.providers.vad == nil {
+		return
+	}
+	if !h.isServerSpeaking() || !h.providers.vad.IsSpeaking() {
+		h.bargeInMs = 0
+		return
+	}
+
+	if pcmRMS(pcm) < h.config.BargeIn.MinEnergy {
+		return
+	}
+	sampleRate := h.clientAudioSampleRate
+	if sampleRate <= 0 {
+		sampleRate = defaultClientSampleRate
+	}
+	h.bargeInMs += len(pcm) / 2 * 1000 / sampleRate
+	if h.bargeInMs >= h.config.BargeIn.MinDuration && atomic.CompareAndSwapInt32(&h.bargeInConfirmed, 0, 1) {
+		h.logger.Debug(fmt.Sprintf("检测到用户插话，持续%dms", h.bargeInMs))
+	}
+}
+
+// handleRealtimeResult 处理实时模式下的识别结果
+// 服务端未在播放时直接发起对话；播放期间识别到打断词立即停止播放，
+// 其他结果需通过插话检测和回声过滤后才打断播放并发起新的对话
+func (h *ConnectionHandler) handleRealtimeResult(result string) {
+	if !h.isServerSpeaking() {
+		h.logger.Info(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
+		h.handleChatMessage(context.Background(), result)
+		return
+	}
+
+	if !h.config.BargeIn.Enabled {
+		h.logger.Info(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
+		h.cancelTurn()
+		h.stopServerSpeak()
+		h.handleChatMessage(context.Background(), result)
+		return
+	}
+
+	// 每条识别结果消耗一次插话确认
+	confirmed := atomic.SwapInt32(&h.bargeInConfirmed, 0) == 1
+
+	if h.isInterruptWord(result) {
+		h.logger.Info(fmt.Sprintf("[%s] 识别到打断词: %s", h.clientListenMode, result))
+		if err := h.handleAbortMessage(); err != nil {
+			h.logger.Error(fmt.Sprintf("打断播放失败: %v", err))
+		}
+		h.providers.asr.Reset()
+		return
+	}
+	if h.providers.vad != nil && !confirmed {
+		h.logger.Debug(fmt.Sprintf("[%s] 未检测到插话，忽略识别结果: %s", h.clientListenMode, result))
+		return
+	}
+	if h.config.BargeIn.EchoGate && h.isEcho(result) {
+		h.logger.Debug(fmt.Sprintf("[%s] 识别结果与播放内容相符，视为回声: %s", h.clientListenMode, result))
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("[%s] 用户插话: %s", h.clientListenMode, result))
+	h.cancelTurn()
+	h.stopServerSpeak()
+	h.handleChatMessage(context.Background(), result)
+}
+
+// isInterruptWord 判断识别结果是否为打断词，允许打断词重复出现，如"停停停"
+func (h *ConnectionHandler) isInterruptWord(text string) bool {
+	_, text = removePunctuationAndLength(text)
+	if text == "" {
+		return false
+	}
+	for _, word := range h.config.BargeIn.InterruptWords {
+		if _, word = removePunctuationAndLength(word); word != "" && strings.ReplaceAll(text, word, "") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isEcho 判断识别结果是否为设备播放的语音被麦克风拾取
+func (h *ConnectionHandler) isEcho(text string) bool {
+	_, text = removePunctuationAndLength(text)
+	_, playing := removePunctuationAndLength(h.currentPlayback().Text)
+	return text != "" && strings.Contains(playing, text)
+}
+
+// pcmRMS 计算16位PCM数据的归一化RMS能量
+func pcmRMS(pcm []byte) float64 {
+	samples := len(pcm) / 2
+	if samples == 0 {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < samples; i++ {
+		amplitude := float64(int16(pcm[2*i])|int16(pcm[2*i+1])<<8) / 32768.0
+		sum += amplitude * amplitude
+	}
+	return math.Sqrt(sum / float64(samples))
+}
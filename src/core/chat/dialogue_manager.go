@@ -3,14 +3,15 @@ package chat
 import (
 	"encoding/json"
 
+	"xiaozhi-server-go/src/core/types"
 	"xiaozhi-server-go/src/core/utils"
 )
 
 type Message struct {
-	Role       string                   `json:"role"`
-	Content    string                   `json:"content,omitempty"`
-	ToolCalls  []map[string]interface{} `json:"tool_calls,omitempty"`
-	ToolCallID string                   `json:"tool_call_id,omitempty"`
+	Role       string           `json:"role"`
+	Content    string           `json:"content,omitempty"`
+	ToolCalls  []types.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
 }
 
 // DialogueManager 管理对话上下文和历史
@@ -34,6 +35,26 @@ func (dm *DialogueManager) Put(message Message) {
 	dm.dialogue = append(dm.dialogue, message)
 }
 
+// SetSystemPrompt 设置系统提示词，对话已以system消息开头时替换其内容，否则插入到最前面
+func (dm *DialogueManager) SetSystemPrompt(content string) {
+	if len(dm.dialogue) > 0 && dm.dialogue[0].Role == "system" {
+		dm.dialogue[0].Content = content
+		return
+	}
+	dm.dialogue = append([]Message{{Role: "system", Content: content}}, dm.dialogue...)
+}
+
+// UpdateLast 修改最后一条指定角色消息的内容，找不到时返回false
+func (dm *DialogueManager) UpdateLast(role string, content string) bool {
+	for i := len(dm.dialogue) - 1; i >= 0; i-- {
+		if dm.dialogue[i].Role == role {
+			dm.dialogue[i].Content = content
+			return true
+		}
+	}
+	return false
+}
+
 // GetLLMDialogue 获取完整对话历史
 func (dm *DialogueManager) GetLLMDialogue() []Message {
 	return dm.dialogue
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const (
+	// connWriteTimeout 单条消息的写入超时，超时说明对端已无法接收，连接随即关闭
+	connWriteTimeout = 10 * time.Second
+	// connQueueSize 每类消息的发送队列长度
+	connQueueSize = 100
+)
+
+// errConnClosed 连接已关闭，消息被丢弃
+var errConnClosed = errors.New("连接已关闭")
+
+// writeDeadliner 支持设置写入超时的连接
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// outboundMessage 待发送的下行消息
+type outboundMessage struct {
+	messageType int
+	data        []byte
+	result      chan error
+}
+
+// connWriter 连接的串行写入器
+// gorilla/websocket不允许并发写入，所有下行消息经队列由单个协程依次写入
+// 文本控制消息(tts状态、stt、情绪等)优先于音频帧发送；连接关闭后的写入直接丢弃并返回errConnClosed
+type connWriter struct {
+	conn    Conn
+	logger  *utils.Logger
+	control chan outboundMessage
+	audio   chan outboundMessage
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newConnWriter 创建写入器并启动写入协程
+func newConnWriter(conn Conn, logger *utils.Logger) *connWriter {
+	w := &connWriter{
+		conn:    conn,
+		logger:  logger,
+		control: make(chan outboundMessage, connQueueSize),
+		audio:   make(chan outboundMessage, connQueueSize),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *connWriter) ReadMessage() (messageType int, p []byte, err error) {
+	return w.conn.ReadMessage()
+}
+
+// WriteMessage 将消息放入发送队列并等待写入完成，可并发调用
+func (w *connWriter) WriteMessage(messageType int, data []byte) error {
+	queue := w.control
+	if messageType == 2 {
+		queue = w.audio
+	}
+
+	msg := outboundMessage{messageType: messageType, data: data, result: make(chan error, 1)}
+	select {
+	case <-w.done:
+		return errConnClosed
+	case queue <- msg:
+	}
+	select {
+	case <-w.done:
+		return errConnClosed
+	case err := <-msg.result:
+		return err
+	}
+}
+
+// Close 停止写入协程并关闭底层连接，可重复调用
+func (w *connWriter) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.done)
+		err = w.conn.Close()
+	})
+	return err
+}
+
+// run 写入协程，每次优先取出控制消息
+func (w *connWriter) run() {
+	for {
+		select {
+		case msg := <-w.control:
+			w.write(msg)
+			continue
+		default:
+		}
+
+		select {
+		case <-w.done:
+			return
+		case msg := <-w.control:
+			w.write(msg)
+		case msg := <-w.audio:
+			w.write(msg)
+		}
+	}
+}
+
+// write 写入一条消息，写入失败时关闭连接，由读取协程结束会话
+func (w *connWriter) write(msg outboundMessage) {
+	if d, ok := w.conn.(writeDeadliner); ok {
+		d.SetWriteDeadline(time.Now().Add(connWriteTimeout))
+	}
+	err := w.conn.WriteMessage(msg.messageType, msg.data)
+	msg.result <- err
+	if err != nil {
+		w.logger.Error(fmt.Sprintf("写入消息失败，关闭连接: %v", err))
+		w.Close()
+	}
+}
@@ -1,39 +1,68 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"xiaozhi-server-go/src/configs"
 	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/iot"
+	"xiaozhi-server-go/src/core/mcp"
 	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/tools"
+	"xiaozhi-server-go/src/core/types"
 	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/core/wakeup"
+	"xiaozhi-server-go/src/device"
 	"xiaozhi-server-go/src/task"
 )
 
+// vadPrerollFrames VAD判定开始说话前缓存的音频帧数，避免丢失语音开头
+const vadPrerollFrames = 10
+
+const (
+	// defaultExitFarewell 未配置exit_farewell时的告别语
+	defaultExitFarewell = "好的，再见，有需要随时叫我"
+	// closeAfterChatTimeout 等待告别语播放完成的最长时间
+	closeAfterChatTimeout = 30 * time.Second
+)
+
 // ConnectionHandler 连接处理器结构
 type ConnectionHandler struct {
 	// 确保实现 AsrEventListener 接口
-	_         providers.AsrEventListener
-	config    *configs.Config
-	logger    *utils.Logger
-	conn      Conn
-	taskMgr   *task.TaskManager
-	providers struct {
+	_          providers.AsrEventListener
+	config     *configs.Config
+	logger     *utils.Logger
+	conn       Conn          // 串行写入器封装后的连接
+	transport  TransportConn // 非WebSocket传输的原始连接，WebSocket连接时为nil
+	taskMgr    *task.TaskManager
+	activation *device.ActivationManager
+	wakeup     *wakeup.Cache // 唤醒问候语缓存，未启用快速回复时为nil
+	providers  struct {
 		asr providers.ASRProvider
 		llm providers.LLMProvider
 		tts providers.TTSProvider
+		vad providers.VADProvider
 	}
 
 	// 会话相关
-	sessionID    string
-	headers      map[string]string
-	clientIP     string
-	clientIPInfo map[string]interface{}
+	sessionID      string
+	headers        map[string]string
+	clientIP       string
+	clientIPInfo   map[string]interface{} // 客户端IP归属地，启用ip_location时后台查询
+	clientIPInfoMu sync.RWMutex
+	agentName      string              // 会话使用的智能体，未配置智能体时为空
+	agent          configs.AgentConfig // 会话使用的智能体配置
+	promptTmpl     *template.Template  // 系统提示词模板，每轮对话开始时重新渲染
 
 	// 客户端音频相关
 	clientAudioFormat        string
@@ -47,39 +76,58 @@ type ConnectionHandler struct {
 	serverAudioFrameDuration int
 
 	// 状态标志
-	clientAbort      bool
 	clientListenMode string
 	isDeviceVerified bool
-	closeAfterChat   bool
+	closeAfterChat   int32 // 1表示本轮语音播放结束后关闭连接
+	lastActivity     int64 // 最近一次交互的时间(UnixNano)
+	idlePrompted     int32 // 1表示已发出空闲提醒
 
 	// 语音处理相关
 	clientVoiceStop bool  // true客户端语音停止, 不再上传语音数据
 	serverVoiceStop int32 // 1表示true服务端语音停止, 不再下发语音数据
+	serverSpeaking  int32 // 1表示服务端正在播放语音(tts start到tts stop之间)
+
+	// 实时模式插话检测
+	bargeInMs        int   // 播放期间用户持续说话的时长(毫秒)
+	bargeInConfirmed int32 // 1表示已确认用户插话，保持到识别结果被处理或本轮播放结束
+
+	// 函数调用相关
+	functions      map[string]*tools.Tool
+	functionsMu    sync.RWMutex
+	iotModel       *iot.Model  // 设备上报的IOT描述符和状态
+	deviceMCP      *mcp.Client // 设备端MCP，设备不支持时为nil
+	deviceMCPTools []string    // 设备端MCP注册的函数名称
+	deviceMCPMu    sync.Mutex
 
 	opusDecoder *utils.OpusDecoder // Opus解码器
+	vadPreroll  [][]byte           // 本地VAD检测到说话前缓存的音频，用于补齐语音开头
+	playback    playbackProgress   // 下行音频的播放进度
+	playbackMu  sync.Mutex
 
 	// 对话相关
 	dialogueManager      *chat.DialogueManager
+	turn                 *chatTurn // 当前一轮对话
+	turnMu               sync.Mutex
 	tts_first_text_index int
 	tts_last_text_index  int
 	client_asr_text      string // 客户端ASR文本
 
 	// 并发控制
 	stopChan         chan struct{}
+	closeOnce        sync.Once
+	workers          sync.WaitGroup // 使用服务提供者的协程，全部退出后才能归还服务提供者
 	clientAudioQueue chan []byte
 	clientTextQueue  chan string
 
 	// TTS任务队列
 	ttsQueue chan struct {
+		ctx       context.Context
 		text      string
 		textIndex int
 	}
 
-	audioMessagesQueue chan struct {
-		filepath  string
-		text      string
-		textIndex int
-	}
+	audioMessagesQueue chan *audioTask
+	ttsSemaphore       chan struct{} // 限制同时合成的句子数
 }
 
 // NewConnectionHandler 创建新的连接处理器
@@ -89,6 +137,7 @@ func NewConnectionHandler(
 		asr providers.ASRProvider
 		llm providers.LLMProvider
 		tts providers.TTSProvider
+		vad providers.VADProvider
 	},
 	logger *utils.Logger,
 ) *ConnectionHandler {
@@ -100,15 +149,15 @@ func NewConnectionHandler(
 		stopChan:         make(chan struct{}),
 		clientAudioQueue: make(chan []byte, 100),
 		clientTextQueue:  make(chan string, 100),
+		functions:        make(map[string]*tools.Tool),
+		iotModel:         iot.NewModel(),
 		ttsQueue: make(chan struct {
+			ctx       context.Context
 			text      string
 			textIndex int
 		}, 100),
-		audioMessagesQueue: make(chan struct {
-			filepath  string
-			text      string
-			textIndex int
-		}, 100),
+		audioMessagesQueue: make(chan *audioTask, 100),
+		ttsSemaphore:       make(chan struct{}, ttsMaxConcurrency),
 
 		tts_last_text_index:  -1,
 		tts_first_text_index: -1,
@@ -125,11 +174,21 @@ func NewConnectionHandler(
 	return handler
 }
 
-// Handle 处理WebSocket连接
+// Handle 处理WebSocket连接，连接断开后返回
+// 返回前等待所有处理协程退出，调用方随后即可归还服务提供者
 func (h *ConnectionHandler) Handle(conn Conn) {
-	defer conn.Close()
+	defer func() {
+		h.Close()
+		h.workers.Wait()
+	}()
 
-	h.conn = conn
+	// 所有下行消息经写入器串行发送
+	h.conn = newConnWriter(conn, h.logger)
+	if tc, ok := conn.(TransportConn); ok {
+		h.transport = tc
+	}
+	h.touchActivity()
+	go h.lookupClientLocation()
 
 	// 发送欢迎消息
 	if err := h.sendHelloMessage(); err != nil {
@@ -138,10 +197,11 @@ func (h *ConnectionHandler) Handle(conn Conn) {
 	}
 
 	// 启动消息处理协程
-	go h.processClientAudioMessagesCoroutine() // 添加客户端音频消息处理协程
-	go h.processClientTextMessagesCoroutine()  // 添加客户端文本消息处理协程
-	go h.processTTSQueueCoroutine()            // 添加TTS队列处理协程
-	go h.sendAudioMessageCoroutine()           // 添加音频消息发送协程
+	h.goWorker(h.processClientAudioMessagesCoroutine) // 添加客户端音频消息处理协程
+	h.goWorker(h.processClientTextMessagesCoroutine)  // 添加客户端文本消息处理协程
+	h.goWorker(h.processTTSQueueCoroutine)            // 添加TTS队列处理协程
+	h.goWorker(h.sendAudioMessageCoroutine)           // 添加音频消息发送协程
+	h.goWorker(h.checkIdleCoroutine)                  // 添加空闲会话检测协程
 
 	// 主消息循环
 	for {
@@ -157,7 +217,7 @@ func (h *ConnectionHandler) Handle(conn Conn) {
 
 			if err := h.handleMessage(messageType, message); err != nil {
 				h.logger.Error(fmt.Sprintf("处理消息失败: %v", err))
-				if h.closeAfterChat {
+				if atomic.LoadInt32(&h.closeAfterChat) == 1 {
 					return
 				}
 			}
@@ -165,16 +225,36 @@ func (h *ConnectionHandler) Handle(conn Conn) {
 	}
 }
 
+// goWorker 启动会话的处理协程，Handle返回前等待其退出
+func (h *ConnectionHandler) goWorker(fn func()) {
+	h.workers.Add(1)
+	go func() {
+		defer h.workers.Done()
+		fn()
+	}()
+}
+
 // handleMessage 处理接收到的消息
 func (h *ConnectionHandler) handleMessage(messageType int, message []byte) error {
 	switch messageType {
 	case 1: // 文本消息
-		h.clientTextQueue <- string(message)
+		h.touchUserActivity()
+		if h.handleDeviceMCPMessage(message) {
+			return nil
+		}
+		// 打断消息不进入队列，避免排在正在处理的对话之后
+		if isAbortMessage(message) {
+			return h.handleAbortMessage()
+		}
+		select {
+		case h.clientTextQueue <- string(message):
+		case <-h.stopChan:
+		}
 		return nil
 	case 2: // 二进制消息（音频数据）
 		if h.clientAudioFormat == "pcm" {
 			// 直接将PCM数据放入队列
-			h.clientAudioQueue <- message
+			h.pushClientAudio(message)
 		} else if h.clientAudioFormat == "opus" {
 			// 检查是否初始化了opus解码器
 			if h.opusDecoder != nil {
@@ -183,17 +263,17 @@ func (h *ConnectionHandler) handleMessage(messageType int, message []byte) error
 				if err != nil {
 					h.logger.Error(fmt.Sprintf("解码Opus音频失败: %v", err))
 					// 即使解码失败，也尝试将原始数据传递给ASR处理
-					h.clientAudioQueue <- message
+					h.pushClientAudio(message)
 				} else {
 					// 解码成功，将PCM数据放入队列
 					h.logger.Debug(fmt.Sprintf("Opus解码成功: %d bytes -> %d bytes", len(message), len(decodedData)))
 					if len(decodedData) > 0 {
-						h.clientAudioQueue <- decodedData
+						h.pushClientAudio(decodedData)
 					}
 				}
 			} else {
 				// 没有解码器，直接传递原始数据
-				h.clientAudioQueue <- message
+				h.pushClientAudio(message)
 			}
 		}
 		return nil
@@ -203,6 +283,14 @@ func (h *ConnectionHandler) handleMessage(messageType int, message []byte) error
 	}
 }
 
+// pushClientAudio 将音频数据放入队列，连接关闭后直接丢弃
+func (h *ConnectionHandler) pushClientAudio(data []byte) {
+	select {
+	case h.clientAudioQueue <- data:
+	case <-h.stopChan:
+	}
+}
+
 // processClientTextMessagesCoroutine 处理文本消息队列
 func (h *ConnectionHandler) processClientTextMessagesCoroutine() {
 	for {
@@ -224,46 +312,140 @@ func (h *ConnectionHandler) processClientAudioMessagesCoroutine() {
 		case <-h.stopChan:
 			return
 		case audioData := <-h.clientAudioQueue:
-			if err := h.providers.asr.AddAudio(audioData); err != nil {
-				h.logger.Error(fmt.Sprintf("处理音频数据失败: %v", err))
+			frames, speechEnd := [][]byte{audioData}, false
+			if h.providers.vad != nil {
+				frames, speechEnd = h.detectVoice(audioData)
+				if h.providers.vad.IsSpeaking() || speechEnd {
+					h.touchUserActivity()
+				}
+				h.trackBargeIn(audioData)
+			}
+			for _, frame := range frames {
+				if err := h.providers.asr.AddAudio(frame); err != nil {
+					h.logger.Error(fmt.Sprintf("处理音频数据失败: %v", err))
+				}
+			}
+			if speechEnd {
+				// 本地检测到说话结束，通知ASR输出最终结果
+				if err := h.providers.asr.Finalize(); err != nil {
+					h.logger.Error(fmt.Sprintf("结束语音识别失败: %v", err))
+				}
 			}
 		}
 	}
 }
 
+// detectVoice 使用本地VAD检测说话状态，返回需要送入ASR的音频以及是否说话结束
+// 仅auto模式按VAD结果过滤静音，manual和realtime模式由客户端控制，音频全部送入ASR
+func (h *ConnectionHandler) detectVoice(data []byte) ([][]byte, bool) {
+	event := h.providers.vad.ProcessAudio(data)
+	if h.clientListenMode != "auto" {
+		return [][]byte{data}, false
+	}
+
+	switch event {
+	case providers.VADEventSpeechStart:
+		h.logger.Debug("VAD检测到开始说话")
+		h.clientVoiceStop = false
+		frames := append(h.vadPreroll, data)
+		h.vadPreroll = nil
+		return frames, false
+	case providers.VADEventSpeechEnd:
+		h.logger.Debug("VAD检测到说话结束")
+		h.clientVoiceStop = true
+		return [][]byte{data}, true
+	}
+
+	if h.providers.vad.IsSpeaking() {
+		return [][]byte{data}, false
+	}
+
+	// 尚未说话，缓存最近几帧，不送入ASR
+	h.vadPreroll = append(h.vadPreroll, data)
+	if len(h.vadPreroll) > vadPrerollFrames {
+		h.vadPreroll = h.vadPreroll[len(h.vadPreroll)-vadPrerollFrames:]
+	}
+	return nil, false
+}
+
 // OnAsrResult 实现 AsrEventListener 接口
 // 返回true则停止语音识别，返回false会继续语音识别
-func (h *ConnectionHandler) OnAsrResult(result string) bool {
-	//h.logger.Info(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
+// 中间结果只作为实时字幕下发；auto和manual模式累积已确定的分句，说话结束后以完整文本发起对话
+func (h *ConnectionHandler) OnAsrResult(result providers.AsrResult) bool {
+	if result.Text != "" {
+		h.touchUserActivity()
+	}
+
+	if !result.IsFinal {
+		if result.Text != "" {
+			text := result.Text
+			if h.clientListenMode != "realtime" {
+				text = h.client_asr_text + text
+			}
+			if err := h.sendSTTPartialMessage(text); err != nil {
+				h.logger.Error(fmt.Sprintf("发送STT中间结果失败: %v", err))
+			}
+		}
+		return false
+	}
+
+	h.logger.Debug(fmt.Sprintf("[%s] ASR分句结果: %s (%dms-%dms)", h.clientListenMode, result.Text, result.StartTime, result.EndTime))
 	if h.clientListenMode == "auto" {
-		if result == "" {
+		if h.providers.vad != nil {
+			// 启用本地VAD时，等VAD判定说话结束后以完整结果发起对话
+			h.client_asr_text += result.Text
+			if !h.clientVoiceStop || !result.IsLast {
+				return false
+			}
+			return h.finishAsr()
+		}
+		if result.Text == "" {
 			return false
 		}
-		h.logger.Info(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
-		h.handleChatMessage(context.Background(), result)
+		h.logger.Info(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result.Text))
+		h.handleChatMessage(context.Background(), result.Text)
 		return true
 	} else if h.clientListenMode == "manual" {
-		h.client_asr_text += result
-		if result != "" {
-			h.logger.Info(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, h.client_asr_text))
-		}
-		if h.clientVoiceStop {
-			h.handleChatMessage(context.Background(), h.client_asr_text)
-			return true
+		h.client_asr_text += result.Text
+		if !h.clientVoiceStop || !result.IsLast {
+			return false
 		}
-		return false
+		return h.finishAsr()
 	} else if h.clientListenMode == "realtime" {
-		if result == "" {
+		if result.Text == "" {
 			return false
 		}
-		h.stopServerSpeak()
-		h.logger.Info(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
-		h.handleChatMessage(context.Background(), result)
+		h.handleRealtimeResult(result.Text)
 		return false
 	}
 	return false
 }
 
+// OnAsrError 实现 AsrEventListener 接口
+// 识别中断时已确定的文本仍然有效，用户已说完则以这部分文本发起对话
+func (h *ConnectionHandler) OnAsrError(err error) {
+	h.logger.Error(fmt.Sprintf("[%s] 语音识别出错: %v", h.clientListenMode, err))
+	if h.clientListenMode != "realtime" && h.clientVoiceStop && h.client_asr_text != "" {
+		h.finishAsr()
+		return
+	}
+	h.client_asr_text = ""
+	h.providers.asr.Reset()
+}
+
+// finishAsr 以累积的识别文本发起对话，没有识别到文本时复位ASR
+func (h *ConnectionHandler) finishAsr() bool {
+	text := h.client_asr_text
+	h.client_asr_text = ""
+	if text == "" {
+		h.providers.asr.Reset()
+		return true
+	}
+	h.logger.Info(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, text))
+	h.handleChatMessage(context.Background(), text)
+	return true
+}
+
 // processClientTextMessage 处理文本数据
 func (h *ConnectionHandler) processClientTextMessage(ctx context.Context, text string) error {
 	// 解析JSON消息
@@ -370,13 +552,37 @@ func (h *ConnectionHandler) handleHelloMessage(msgMap map[string]interface{}) er
 		h.logger.Info("Opus解码器初始化成功")
 	}
 
+	// 设备支持MCP时获取设备端工具，重新hello后不再支持时移除之前的设备工具
+	features, _ := msgMap["features"].(map[string]interface{})
+	if enabled, _ := features["mcp"].(bool); enabled {
+		go h.initDeviceMCP()
+	} else {
+		h.closeDeviceMCP()
+	}
+
 	return nil
 }
 
-// handleAbortMessage 处理中止消息
+// isAbortMessage 判断是否为打断消息
+func isAbortMessage(message []byte) bool {
+	if !bytes.Contains(message, []byte(`"abort"`)) {
+		return false
+	}
+	var msg struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(message, &msg) == nil && msg.Type == "abort"
+}
+
+// handleAbortMessage 处理中止消息，取消当前一轮对话
 func (h *ConnectionHandler) handleAbortMessage() error {
-	h.clientAbort = true
+	h.logger.Info("收到客户端打断消息")
+	h.cancelTurn()
 	h.stopServerSpeak()
+	if err := h.sendTTSMessage("stop", "", 0); err != nil {
+		return fmt.Errorf("发送TTS停止状态失败: %v", err)
+	}
+	h.clearSpeakStatus()
 	return nil
 }
 
@@ -399,6 +605,9 @@ func (h *ConnectionHandler) handleListenMessage(msgMap map[string]interface{}) e
 	case "start":
 		h.clientVoiceStop = false
 		h.client_asr_text = ""
+		if h.providers.vad != nil {
+			h.providers.vad.Reset()
+		}
 	case "stop":
 		h.clientVoiceStop = true
 		h.logger.Info("客户端停止语音识别")
@@ -409,29 +618,105 @@ func (h *ConnectionHandler) handleListenMessage(msgMap map[string]interface{}) e
 
 		// 处理text参数
 		if text, ok := msgMap["text"].(string); ok {
-			// TODO: 实现去除标点和长度的函数
-			// _, text = removePunctuationAndLength(text)
+			length, word := removePunctuationAndLength(text)
+			if length == 0 {
+				return nil
+			}
+			if h.config.Wakeup.QuickReply && h.isWakeupWord(word) && !h.isNeedAuth() {
+				return h.handleWakeupWord(context.Background(), text)
+			}
 			return h.handleChatMessage(context.Background(), text)
 		}
 	}
 	return nil
 }
 
+// isWakeupWord 判断文本是否为唤醒词，text需已去除标点
+func (h *ConnectionHandler) isWakeupWord(text string) bool {
+	for _, word := range h.config.Wakeup.Words {
+		if _, word = removePunctuationAndLength(word); word == text {
+			return true
+		}
+	}
+	return false
+}
+
+// handleWakeupWord 唤醒后直接播放问候语，不请求LLM
+// 优先使用预先合成的音频，缓存尚未就绪时现场合成
+func (h *ConnectionHandler) handleWakeupWord(ctx context.Context, text string) error {
+	reply, cached := wakeup.Reply{}, false
+	if h.wakeup != nil {
+		reply, cached = h.wakeup.Random()
+	}
+	if !cached {
+		replies := h.config.Wakeup.Replies
+		if len(replies) == 0 {
+			return h.handleChatMessage(ctx, text)
+		}
+		reply.Text = replies[rand.Intn(len(replies))]
+	}
+
+	ctx, turn := h.startTurn(ctx)
+	defer h.endTurn(turn)
+
+	h.logger.Info(fmt.Sprintf("收到唤醒词: %s, 回复: %s", text, reply.Text))
+	if err := h.sendSTTMessage(text); err != nil {
+		return fmt.Errorf("发送STT消息失败: %v", err)
+	}
+	if h.config.Wakeup.SaveHistory {
+		h.dialogueManager.Put(chat.Message{Role: "user", Content: text})
+		h.putAssistantReply(ctx, reply.Text)
+	}
+
+	if !cached {
+		return h.speakText(ctx, reply.Text)
+	}
+	if err := h.sendTTSMessage("start", "", 0); err != nil {
+		return fmt.Errorf("发送TTS开始状态失败: %v", err)
+	}
+	atomic.StoreInt32(&h.serverVoiceStop, 0)
+	h.recode_first_last_text(reply.Text, 1)
+	h.playAudioFile(ctx, reply.File, reply.Text, 1)
+	return nil
+}
+
 // handleIotMessage 处理IOT设备消息
 func (h *ConnectionHandler) handleIotMessage(msgMap map[string]interface{}) error {
-	if descriptors, ok := msgMap["descriptors"].([]interface{}); ok {
-		// 处理设备描述符
-		// 这里需要实现具体的IOT设备描述符处理逻辑
-		h.logger.Info(fmt.Sprintf("收到IOT设备描述符：%v", descriptors))
+	if descriptors, ok := msgMap["descriptors"]; ok {
+		// 设备描述符转换为可供LLM调用的函数
+		things, err := h.iotModel.UpdateDescriptors(descriptors)
+		if err != nil {
+			return err
+		}
+		for _, thing := range things {
+			for _, tool := range h.iotModel.Tools(thing, h.sendIotCommands) {
+				h.RegisterFunction(tool)
+			}
+			h.logger.Info(fmt.Sprintf("注册IOT设备: %s(%s)", thing.Name, thing.Description))
+		}
 	}
-	if states, ok := msgMap["states"].([]interface{}); ok {
-		// 处理设备状态
-		// 这里需要实现具体的IOT设备状态处理逻辑
-		h.logger.Info(fmt.Sprintf("收到IOT设备状态：%v", states))
+	if states, ok := msgMap["states"]; ok {
+		if err := h.iotModel.UpdateStates(states); err != nil {
+			return err
+		}
+		h.logger.Debug(fmt.Sprintf("收到IOT设备状态：%v", states))
 	}
 	return nil
 }
 
+// sendIotCommands 向设备下发IOT指令
+func (h *ConnectionHandler) sendIotCommands(commands []iot.Command) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"type":       "iot",
+		"session_id": h.sessionID,
+		"commands":   commands,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化IOT指令失败: %v", err)
+	}
+	return h.conn.WriteMessage(1, data)
+}
+
 // sendEmotionMessage 发送情绪消息
 func (h *ConnectionHandler) sendEmotionMessage(emotion string) error {
 	data := map[string]interface{}{
@@ -448,10 +733,14 @@ func (h *ConnectionHandler) sendEmotionMessage(emotion string) error {
 }
 
 // handleChatMessage 处理聊天消息
+// 每次用户输入开始新的一轮对话，上一轮尚未结束的LLM请求和语音播放随之取消
 func (h *ConnectionHandler) handleChatMessage(ctx context.Context, text string) error {
+	ctx, turn := h.startTurn(ctx)
+	defer h.endTurn(turn)
+
 	// 判断是否需要验证
 	if h.isNeedAuth() {
-		if err := h.checkAndBroadcastAuthCode(); err != nil {
+		if err := h.checkAndBroadcastAuthCode(ctx); err != nil {
 			h.logger.Error(fmt.Sprintf("检查认证码失败: %v", err))
 			return err
 		}
@@ -459,6 +748,11 @@ func (h *ConnectionHandler) handleChatMessage(ctx context.Context, text string)
 		return nil
 	}
 
+	// 退出指令不经过LLM，直接告别并关闭连接
+	if h.isExitCommand(text) {
+		return h.handleExitCommand(ctx, text)
+	}
+
 	// 立即发送 stt 消息
 	err := h.sendSTTMessage(text)
 	if err != nil {
@@ -480,98 +774,284 @@ func (h *ConnectionHandler) handleChatMessage(ctx context.Context, text string)
 
 	h.logger.Info("收到聊天消息: " + text)
 
+	// 按当前时间和设备状态重新渲染系统提示词
+	h.refreshSystemPrompt()
+
 	// 添加用户消息到对话历史
 	h.dialogueManager.Put(chat.Message{
 		Role:    "user",
 		Content: text,
 	})
 
-	// 转换消息格式并使用LLM生成回复
+	atomic.StoreInt32(&h.serverVoiceStop, 0)
+
+	// LLM请求函数调用时执行函数并把结果交回LLM，直到LLM给出回复
+	textIndex := 0
+	for round := 0; ; round++ {
+		functions := h.getFunctions()
+		if round >= maxFunctionCallRounds {
+			h.logger.Warn(fmt.Sprintf("函数调用超过%d轮，要求LLM直接回复", maxFunctionCallRounds))
+			functions = nil
+		}
+
+		content, toolCalls, err := h.generateResponse(ctx, functions, &textIndex)
+		if err != nil {
+			return err
+		}
+
+		if len(toolCalls) == 0 || ctx.Err() != nil {
+			// 添加助手回复到对话历史，被打断时由下一轮改为用户实际听到的部分
+			h.putAssistantReply(ctx, content)
+			return nil
+		}
+
+		h.dialogueManager.Put(chat.Message{
+			Role:      "assistant",
+			Content:   content,
+			ToolCalls: toolCalls,
+		})
+
+		// 工具可以直接给出回复，此时不再请求LLM
+		var replies []string
+		finished := false
+		for _, call := range toolCalls {
+			result := h.executeFunction(ctx, call)
+			h.dialogueManager.Put(chat.Message{
+				Role:       "tool",
+				ToolCallID: call.ID,
+				Content:    result.Content,
+			})
+
+			switch result.Action {
+			case tools.ActionResponse:
+				finished = true
+			case tools.ActionCloseChat:
+				finished = true
+				h.closeAfterSpeak()
+			case tools.ActionPlayAudio:
+				finished = true
+				textIndex++
+				h.recode_first_last_text(result.Response, textIndex)
+				h.playAudioFile(ctx, result.AudioFile, result.Response, textIndex)
+				replies = append(replies, result.Response)
+				continue
+			default:
+				continue
+			}
+			textIndex++
+			h.recode_first_last_text(result.Response, textIndex)
+			h.SpeakAndPlay(ctx, result.Response, textIndex)
+			replies = append(replies, result.Response)
+		}
+
+		if finished {
+			h.putAssistantReply(ctx, joinStrings(replies))
+			return nil
+		}
+	}
+}
+
+// generateResponse 请求LLM生成回复并分段播放，返回回复文本和LLM请求的函数调用
+// textIndex 为本次对话中已播放的文本段序号，多轮函数调用之间连续递增
+func (h *ConnectionHandler) generateResponse(ctx context.Context, functions []types.Function, textIndex *int) (string, []types.ToolCall, error) {
+	// 转换消息格式
 	messages := make([]providers.Message, 0)
 	for _, msg := range h.dialogueManager.GetLLMDialogue() {
 		messages = append(messages, providers.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
 		})
 	}
 
-	// 使用LLM生成回复
-	responses, err := h.providers.llm.Response(ctx, h.sessionID, messages)
-	if err != nil {
-		return fmt.Errorf("LLM生成回复失败: %v", err)
-	}
-
 	// 处理回复
 	var responseMessage []string
 	processedChars := 0
-	textIndex := 0
-
-	atomic.StoreInt32(&h.serverVoiceStop, 0)
-
-	for content := range responses {
+	speak := func(content string) {
 		responseMessage = append(responseMessage, content)
-		if h.clientAbort {
-			break
-		}
 
 		// 处理分段
 		fullText := joinStrings(responseMessage)
 		currentText := fullText[processedChars:]
 
-		//h.logger.Info("LLM生成回复: " + fmt.Sprintf("%s", fullText))
-
 		// 按标点符号分割
 		if segment, chars := splitAtLastPunctuation(currentText); chars > 0 {
-			textIndex++
-			h.recode_first_last_text(segment, textIndex)
-			h.SpeakAndPlay(segment, textIndex)
+			*textIndex++
+			h.recode_first_last_text(segment, *textIndex)
+			h.SpeakAndPlay(ctx, segment, *textIndex)
 			processedChars += chars
 		}
 	}
 
+	var toolCalls []types.ToolCall
+	if len(functions) == 0 {
+		responses, err := h.providers.llm.Response(ctx, h.sessionID, messages)
+		if err != nil {
+			return "", nil, fmt.Errorf("LLM生成回复失败: %v", err)
+		}
+		for content := range responses {
+			if ctx.Err() != nil {
+				// 本轮已取消，LLM请求随ctx结束，丢弃剩余输出
+				go drainChannel(responses)
+				break
+			}
+			speak(content)
+		}
+	} else {
+		responses, err := h.providers.llm.ResponseWithFunctions(ctx, h.sessionID, messages, functions)
+		if err != nil {
+			return "", nil, fmt.Errorf("LLM生成回复失败: %v", err)
+		}
+		for response := range responses {
+			if ctx.Err() != nil {
+				go drainChannel(responses)
+				break
+			}
+			if response.Error != "" {
+				h.logger.Error(fmt.Sprintf("LLM生成回复出错: %s", response.Error))
+			}
+			if len(response.ToolCalls) > 0 {
+				toolCalls = mergeToolCalls(toolCalls, response.ToolCalls)
+			}
+			if response.Content != "" {
+				speak(response.Content)
+			}
+		}
+	}
+
 	// 处理剩余文本
 	remainingText := joinStrings(responseMessage)[processedChars:]
-	if remainingText != "" {
-		textIndex++
-		h.recode_first_last_text(remainingText, textIndex)
-		h.SpeakAndPlay(remainingText, textIndex)
+	if remainingText != "" && ctx.Err() == nil {
+		*textIndex++
+		h.recode_first_last_text(remainingText, *textIndex)
+		h.SpeakAndPlay(ctx, remainingText, *textIndex)
 	}
 
-	// 分析回复并发送相应的情绪
-	content := joinStrings(responseMessage)
-
-	// 添加助手回复到对话历史
-	h.dialogueManager.Put(chat.Message{
-		Role:    "assistant",
-		Content: content,
-	})
-
-	return nil
+	return joinStrings(responseMessage), completeToolCalls(toolCalls), nil
 }
 
 // isNeedAuth 判断是否需要验证
 func (h *ConnectionHandler) isNeedAuth() bool {
-	if !h.config.Server.Auth.Enabled {
+	if !h.config.Server.Auth.Enabled && !h.config.Server.Activation.Enabled {
 		return false
 	}
+	// 会话期间管理员可能已确认激活码，重新检查绑定状态
+	if !h.isDeviceVerified && h.activation != nil && h.activation.IsActivated(h.headers["device-id"]) {
+		h.isDeviceVerified = true
+		h.logger.Info(fmt.Sprintf("设备已激活: %s", h.headers["device-id"]))
+	}
 	return !h.isDeviceVerified
 }
 
 // checkAndBroadcastAuthCode 检查并广播认证码
-func (h *ConnectionHandler) checkAndBroadcastAuthCode() error {
-	// 这里简化了认证逻辑，实际需要根据具体需求实现
-	text := "请联系管理员进行设备认证"
-	return h.SpeakAndPlay(text, 0)
+func (h *ConnectionHandler) checkAndBroadcastAuthCode(ctx context.Context) error {
+	deviceID := h.headers["device-id"]
+	if h.activation == nil || !h.activation.Enabled() || deviceID == "" {
+		text := "请联系管理员进行设备认证"
+		return h.speakText(ctx, text)
+	}
+
+	code, _, err := h.activation.GetOrCreateCode(deviceID)
+	if err != nil {
+		return fmt.Errorf("获取激活码失败: %v", err)
+	}
+	h.logger.Info(fmt.Sprintf("设备%s未激活，激活码: %s", deviceID, code))
+
+	// 逐位朗读激活码，避免TTS按数值读出
+	digits := strings.Join(strings.Split(code, ""), " ")
+	text := fmt.Sprintf("请登录控制面板，输入验证码 %s 绑定设备。", digits)
+	return h.speakText(ctx, text)
+}
+
+// speakText 播报一段固定文本，作为一轮完整的TTS下发，ctx取消时停止播报
+func (h *ConnectionHandler) speakText(ctx context.Context, text string) error {
+	if err := h.sendTTSMessage("start", "", 0); err != nil {
+		return fmt.Errorf("发送TTS开始状态失败: %v", err)
+	}
+	atomic.StoreInt32(&h.serverVoiceStop, 0)
+	h.recode_first_last_text(text, 1)
+	return h.SpeakAndPlay(ctx, text, 1)
+}
+
+// isExitCommand 判断文本是否为退出指令，忽略标点和空白
+func (h *ConnectionHandler) isExitCommand(text string) bool {
+	_, text = removePunctuationAndLength(text)
+	if text == "" {
+		return false
+	}
+	for _, cmd := range h.config.CMDExit {
+		if _, cmd = removePunctuationAndLength(cmd); cmd == text {
+			return true
+		}
+	}
+	return false
+}
+
+// handleExitCommand 处理退出指令
+func (h *ConnectionHandler) handleExitCommand(ctx context.Context, text string) error {
+	h.logger.Info(fmt.Sprintf("收到退出指令: %s", text))
+	if err := h.sendSTTMessage(text); err != nil {
+		return fmt.Errorf("发送STT消息失败: %v", err)
+	}
+	return h.sayGoodbye(ctx)
+}
+
+// sayGoodbye 播报告别语，播放结束后关闭连接，设备随即进入休眠
+func (h *ConnectionHandler) sayGoodbye(ctx context.Context) error {
+	farewell := h.config.ExitFarewell
+	if farewell == "" {
+		farewell = defaultExitFarewell
+	}
+	h.closeAfterSpeak()
+	return h.speakText(ctx, farewell)
+}
+
+// closeAfterSpeak 标记本轮语音播放结束后关闭连接
+// TTS失败或播放被打断时收不到最后一段音频，超时后强制关闭
+func (h *ConnectionHandler) closeAfterSpeak() {
+	if !atomic.CompareAndSwapInt32(&h.closeAfterChat, 0, 1) {
+		return
+	}
+	time.AfterFunc(closeAfterChatTimeout, func() {
+		select {
+		case <-h.stopChan:
+		default:
+			h.logger.Warn("等待告别语播放超时，关闭连接")
+			h.Close()
+		}
+	})
 }
 
 // processTTSQueueCoroutine 处理TTS队列
+// 按文本顺序把音频任务放入发送队列后并发合成，最多ttsMaxConcurrency句同时合成
+// 发送协程按队列顺序等待合成结果，保证音频按textIndex顺序下发
 func (h *ConnectionHandler) processTTSQueueCoroutine() {
 	for {
 		select {
 		case <-h.stopChan:
 			return
 		case task := <-h.ttsQueue:
-			h.processTTSTask(task.text, task.textIndex)
+			select {
+			case h.ttsSemaphore <- struct{}{}:
+			case <-h.stopChan:
+				return
+			}
+			if atomic.LoadInt32(&h.serverVoiceStop) == 1 || task.ctx.Err() != nil { // 等待期间被打断
+				<-h.ttsSemaphore
+				h.logger.Info(fmt.Sprintf("processTTSQueueCoroutine 服务端语音停止, 丢弃TTS任务：%s", task.text))
+				continue
+			}
+
+			audio := newAudioTask(task.ctx, task.text, task.textIndex)
+			select {
+			case h.audioMessagesQueue <- audio:
+			case <-h.stopChan:
+				<-h.ttsSemaphore
+				audio.release()
+				return
+			}
+			h.goWorker(func() { h.processTTSTask(audio, func() { <-h.ttsSemaphore }) })
 		}
 	}
 }
@@ -582,68 +1062,127 @@ func (h *ConnectionHandler) sendAudioMessageCoroutine() {
 		case <-h.stopChan:
 			return
 		case task := <-h.audioMessagesQueue:
-			h.sendAudioMessage(task.filepath, task.text, task.textIndex)
+			// 等待本句合成完成，后面的句子此时仍在并发合成
+			select {
+			case <-task.ready:
+			case <-task.ctx.Done():
+				// 所属的一轮已取消，不必等待合成结束
+				task.cancel()
+				task.release()
+				continue
+			case <-h.stopChan:
+				task.cancel()
+				task.release()
+				return
+			}
+			filepath, stream := task.result()
+			h.sendAudioMessage(task.ctx, filepath, stream, task.text, task.textIndex)
+			task.release()
 		}
 	}
 }
 
-func (h *ConnectionHandler) sendAudioMessage(filepath string, text string, textIndex int) {
-	if len(filepath) == 0 {
-		return
+// sendAudioMessage 下发一句音频，ctx为所属的一轮对话，取消后不再下发
+func (h *ConnectionHandler) sendAudioMessage(ctx context.Context, filepath string, stream *providers.AudioStream, text string, textIndex int) {
+	if stream != nil {
+		defer stream.Close()
 	}
 
-	if atomic.LoadInt32(&h.serverVoiceStop) == 1 { // 服务端语音停止
+	if atomic.LoadInt32(&h.serverVoiceStop) == 1 || ctx.Err() != nil { // 服务端语音停止
 		h.logger.Info(fmt.Sprintf("sendAudioMessage 服务端语音停止, 不再发送音频数据：%s", text))
 		return
 	}
 
+	turn := turnFromContext(ctx)
 	defer func() {
-		if textIndex == h.tts_last_text_index {
+		// 本轮已取消时textIndex可能与新一轮的序号重复，不能结束新一轮的播放
+		if textIndex == h.tts_last_text_index && ctx.Err() == nil {
+			if turn != nil {
+				turn.markCompleted()
+			}
 			h.sendTTSMessage("stop", "", textIndex)
 			h.clearSpeakStatus()
+			if atomic.LoadInt32(&h.closeAfterChat) == 1 {
+				h.logger.Info("告别语播放完成，关闭连接")
+				h.Close()
+			}
 		}
 	}()
 
-	var audioData [][]byte
-	var duration float64
-	var err error
+	// 合成失败的句子直接跳过，最后一句失败时也会在defer中结束本轮播放
+	if len(filepath) == 0 && stream == nil {
+		return
+	}
 
-	// 使用TTS提供者的方法将音频转为Opus格式
-	if h.serverAudioFormat == "pcm" {
-		h.logger.Info("服务端音频格式为PCM，直接发送")
-		audioData, duration, err = utils.AudioToPCMData(filepath)
+	frameDuration := time.Duration(h.serverAudioFrameDuration) * time.Millisecond
+	var source audioFrameSource
+	var total time.Duration // 整句音频的时长，流式合成时未知
+	if stream != nil {
+		// 流式合成的音频边读取边编码，无需等待整句合成完成
+		streamSource, closeSource, err := h.newStreamFrameSource(stream, frameDuration)
 		if err != nil {
-			h.logger.Error(fmt.Sprintf("音频转PCM失败: %v", err))
+			h.logger.Error(fmt.Sprintf("创建音频流失败: %v", err))
 			return
 		}
-	} else if h.serverAudioFormat == "opus" {
-		audioData, duration, err = utils.AudioToOpusData(filepath)
-		if err != nil {
-			h.logger.Error(fmt.Sprintf("音频转Opus失败: %v", err))
-			return
+		defer closeSource()
+		source = streamSource
+	} else {
+		var audioData [][]byte
+		var duration float64
+		var err error
+
+		// 使用TTS提供者的方法将音频转为Opus格式
+		if h.serverAudioFormat == "pcm" {
+			h.logger.Info("服务端音频格式为PCM，直接发送")
+			audioData, duration, err = utils.AudioToPCMData(filepath)
+			if err != nil {
+				h.logger.Error(fmt.Sprintf("音频转PCM失败: %v", err))
+				return
+			}
+			// PCM为整段数据，按帧时长切分后匀速发送
+			audioData = splitPCMFrames(joinFrames(audioData), duration, frameDuration)
+		} else if h.serverAudioFormat == "opus" {
+			audioData, _, err = utils.AudioToOpusData(filepath)
+			if err != nil {
+				h.logger.Error(fmt.Sprintf("音频转Opus失败: %v", err))
+				return
+			}
 		}
+		source = sliceFrameSource(audioData)
+		total = time.Duration(len(audioData)) * frameDuration
 	}
 
-	//fmt.Println("音频时长:", duration)
-
 	// 发送TTS状态开始通知
 	if err := h.sendTTSMessage("sentence_start", text, textIndex); err != nil {
 		h.logger.Error(fmt.Sprintf("发送TTS开始状态失败: %v", err))
 		return
 	}
 
-	// 发送音频数据
-	for _, chunk := range audioData {
-		if err := h.conn.WriteMessage(2, chunk); err != nil {
-			h.logger.Error(fmt.Sprintf("发送Opus音频数据失败: %v", err))
-			return
+	// 播放期间不计入空闲时间
+	h.touchActivity()
+	defer h.touchActivity()
+
+	// 按帧时长匀速发送音频数据
+	h.logger.Info(fmt.Sprintf("TTS发送(%s): \"%s\" (索引:%d)", h.serverAudioFormat, text, textIndex))
+	played, err := h.sendAudioFrames(ctx, source, frameDuration, text, textIndex)
+	if err == errAudioInterrupted {
+		h.logger.Info(fmt.Sprintf("%s音频播放被打断: \"%s\" (索引:%d，已播放:%v)", h.serverAudioFormat, text, textIndex, played))
+		if turn != nil {
+			if total == 0 {
+				total = h.currentPlayback().Sent
+			}
+			turn.addSpoken(heardText(text, played, total))
 		}
+		return
+	}
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("发送%s音频数据失败: %v", h.serverAudioFormat, err))
+		return
+	}
+	h.logger.Info(fmt.Sprintf("%s音频数据发送完成, 已播放: %v", h.serverAudioFormat, played))
+	if turn != nil {
+		turn.addSpoken(text)
 	}
-	h.logger.Info(fmt.Sprintf("TTS发送(%s): \"%s\" (索引:%d，时长:%f)", h.serverAudioFormat, text, textIndex, duration))
-	now := time.Now()
-	time.Sleep(time.Duration(duration*1000) * time.Millisecond)
-	spent := time.Since(now)
-	h.logger.Info(fmt.Sprintf("%s音频数据发送完成, 已休眠: %v", h.serverAudioFormat, spent))
 	// 发送TTS状态结束通知
 	if err := h.sendTTSMessage("sentence_end", text, textIndex); err != nil {
 		h.logger.Error(fmt.Sprintf("发送TTS结束状态失败: %v", err))
@@ -672,6 +1211,7 @@ clearAudioQueue:
 		select {
 		case task := <-h.audioMessagesQueue:
 			h.logger.Info(fmt.Sprintf("丢弃一个音频任务: %s", task.text))
+			task.cancel()
 		default:
 			// 队列已清空，退出循环
 			return
@@ -679,45 +1219,66 @@ clearAudioQueue:
 	}
 }
 
-// processTTSTask 处理单个TTS任务
-func (h *ConnectionHandler) processTTSTask(text string, textIndex int) {
-	if text == "" {
+// processTTSTask 合成单句文本，结果交给发送协程
+// release 释放合成并发名额，流式合成时在音频流读取完毕或关闭后释放
+func (h *ConnectionHandler) processTTSTask(task *audioTask, release func()) {
+	text, textIndex := task.text, task.textIndex
+
+	// 支持流式合成时直接下发音频流，不生成音频文件
+	if streamer, ok := h.providers.tts.(providers.TTSStreamProvider); ok {
+		stream, err := streamer.ToTTSStream(task.ctx, text)
+		if err != nil {
+			release()
+			h.logger.Error(fmt.Sprintf("TTS流式合成失败:text(%s) %v", text, err))
+			task.finish("", nil)
+			return
+		}
+		h.logger.Info(fmt.Sprintf("TTS流式合成开始: text(%s), index(%d)", text, textIndex))
+		task.finish("", newPrefetchStream(stream, release))
 		return
 	}
+	defer release()
 
 	// 生成语音文件
 	filepath, err := h.providers.tts.ToTTS(text)
 	if err != nil {
 		h.logger.Error(fmt.Sprintf("TTS转换失败:text(%s) %v", text, err))
+		task.finish("", nil)
 		return
 	} else {
 		h.logger.Info(fmt.Sprintf("TTS转换成功: text(%s), index(%d) %s", text, textIndex, filepath))
 	}
-	if atomic.LoadInt32(&h.serverVoiceStop) == 1 { // 服务端语音停止
-		h.logger.Info(fmt.Sprintf("processTTSTask 服务端语音停止, 不再发送音频数据：%s", text))
-		return
+	task.finish(filepath, nil)
+}
+
+// playAudioFile 直接播放音频文件，不经过TTS
+func (h *ConnectionHandler) playAudioFile(ctx context.Context, filepath string, text string, textIndex int) {
+	task := newAudioFileTask(ctx, filepath, text, textIndex)
+	select {
+	case h.audioMessagesQueue <- task:
+	case <-h.stopChan:
+		task.release()
 	}
-	h.audioMessagesQueue <- struct {
-		filepath  string
-		text      string
-		textIndex int
-	}{filepath, text, textIndex}
 }
 
-// speakAndPlay 合成并播放语音
-func (h *ConnectionHandler) SpeakAndPlay(text string, textIndex int) error {
+// speakAndPlay 合成并播放语音，ctx取消后停止合成和播放
+func (h *ConnectionHandler) SpeakAndPlay(ctx context.Context, text string, textIndex int) error {
 	if text == "" {
 		return nil
 	}
-	if atomic.LoadInt32(&h.serverVoiceStop) == 1 { // 服务端语音停止
+	if atomic.LoadInt32(&h.serverVoiceStop) == 1 || ctx.Err() != nil { // 服务端语音停止
 		h.logger.Info(fmt.Sprintf("speakAndPlay 服务端语音停止, 不再发送音频数据：%s", text))
 		return nil
 	}
 	// 将任务加入队列，不阻塞当前流程
-	h.ttsQueue <- struct {
+	select {
+	case h.ttsQueue <- struct {
+		ctx       context.Context
 		text      string
 		textIndex int
-	}{text, textIndex}
+	}{ctx, text, textIndex}:
+	case <-h.stopChan:
+	}
 
 	return nil
 }
@@ -736,6 +1297,13 @@ func (h *ConnectionHandler) sendTTSMessage(state string, text string, textIndex
 	if err != nil {
 		return fmt.Errorf("序列化%s状态失败: %v", state, err)
 	}
+	switch state {
+	case "start":
+		atomic.StoreInt32(&h.serverSpeaking, 1)
+	case "stop":
+		atomic.StoreInt32(&h.serverSpeaking, 0)
+		atomic.StoreInt32(&h.bargeInConfirmed, 0)
+	}
 	if err := h.conn.WriteMessage(1, data); err != nil {
 		return fmt.Errorf("发送%s状态失败: %v", state, err)
 	}
@@ -761,6 +1329,21 @@ func (h *ConnectionHandler) sendSTTMessage(text string) error {
 	return nil
 }
 
+// sendSTTPartialMessage 发送识别中间结果，客户端可用于实时字幕
+func (h *ConnectionHandler) sendSTTPartialMessage(text string) error {
+	sttMsg := map[string]interface{}{
+		"type":       "stt",
+		"state":      "partial",
+		"text":       text,
+		"session_id": h.sessionID,
+	}
+	jsonData, err := json.Marshal(sttMsg)
+	if err != nil {
+		return fmt.Errorf("序列化 STT 消息失败: %v", err)
+	}
+	return h.conn.WriteMessage(1, jsonData)
+}
+
 func (h *ConnectionHandler) clearSpeakStatus() {
 	h.logger.Info("清除服务端讲话状态 ")
 	h.tts_last_text_index = -1
@@ -779,6 +1362,18 @@ func (h *ConnectionHandler) recode_first_last_text(text string, text_index int)
 	h.tts_last_text_index = text_index
 }
 
+// removePunctuationAndLength 去除标点符号和表情，返回处理后的字符数和文本
+func removePunctuationAndLength(text string) (int, string) {
+	text = utils.GetStringWithoutPunctuation(text)
+	return utf8.RuneCountInString(text), text
+}
+
+// drainChannel 丢弃通道中的剩余数据，避免提前退出读取后发送方阻塞
+func drainChannel[T any](ch <-chan T) {
+	for range ch {
+	}
+}
+
 // joinStrings 连接字符串切片
 func joinStrings(strs []string) string {
 	var result string
@@ -819,6 +1414,13 @@ func (h *ConnectionHandler) sendHelloMessage() error {
 		"channels":       h.serverAudioChannels,
 		"frame_duration": h.serverAudioFrameDuration,
 	}
+	// MQTT+UDP等传输方式需要在hello中下发音频通道参数
+	if h.transport != nil {
+		hello["transport"] = h.transport.TransportType()
+		for k, v := range h.transport.HelloParams() {
+			hello[k] = v
+		}
+	}
 	data, err := json.Marshal(hello)
 	if err != nil {
 		return fmt.Errorf("序列化欢迎消息失败: %v", err)
@@ -836,11 +1438,35 @@ func (h *ConnectionHandler) closeOpusDecoder() {
 	}
 }
 
-// Close 清理资源
+// Close 清理资源，可重复调用
+// 停止所有协程、关闭底层连接、丢弃未处理的队列数据并释放Opus解码器
 func (h *ConnectionHandler) Close() {
-	close(h.stopChan)
-	close(h.clientAudioQueue)
-	close(h.clientTextQueue)
+	h.closeOnce.Do(func() {
+		close(h.stopChan)
+		h.cancelTurn()
+		if h.conn != nil {
+			h.conn.Close()
+		}
 
-	h.closeOpusDecoder()
+		// 队列可能仍有协程在写入，这里只清空不关闭
+		h.drainQueues()
+		h.closeOpusDecoder()
+		h.closeDeviceMCP()
+	})
+}
+
+// drainQueues 丢弃所有队列中尚未处理的数据
+func (h *ConnectionHandler) drainQueues() {
+	for {
+		select {
+		case <-h.clientAudioQueue:
+		case <-h.clientTextQueue:
+		case <-h.ttsQueue:
+		case task := <-h.audioMessagesQueue:
+			task.cancel()
+			task.release()
+		default:
+			return
+		}
+	}
 }
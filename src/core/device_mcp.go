@@ -0,0 +1,121 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"xiaozhi-server-go/src/core/mcp"
+)
+
+// deviceMCPInitTimeout 设备端MCP初始化和获取工具列表的超时时间
+const deviceMCPInitTimeout = 10 * time.Second
+
+// initDeviceMCP 设备声明支持MCP时，初始化设备端MCP并将设备工具注册为会话函数
+// 设备重复发送hello时，先移除上一个设备端MCP注册的工具
+func (h *ConnectionHandler) initDeviceMCP() {
+	client := mcp.NewDeviceClient("device", h.sendMCPMessage, h.logger)
+	h.replaceDeviceMCP(client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), deviceMCPInitTimeout)
+	defer cancel()
+
+	if err := client.Start(ctx); err != nil {
+		h.logger.Error(fmt.Sprintf("设备端MCP初始化失败: %v", err))
+		h.removeDeviceMCP(client)
+		return
+	}
+	deviceTools, err := client.ListTools(ctx)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("获取设备端MCP工具失败: %v", err))
+		h.removeDeviceMCP(client)
+		return
+	}
+
+	h.deviceMCPMu.Lock()
+	defer h.deviceMCPMu.Unlock()
+	if h.deviceMCP != client {
+		// 初始化期间设备重新发送了hello或连接已关闭，工具交给新的客户端注册
+		return
+	}
+	for _, t := range deviceTools {
+		tool := mcp.NewTool(client, t)
+		h.RegisterFunction(tool)
+		h.deviceMCPTools = append(h.deviceMCPTools, tool.Function.Name)
+	}
+	h.logger.Info(fmt.Sprintf("设备端MCP初始化完成，工具数: %d", len(deviceTools)))
+}
+
+// sendMCPMessage 将JSON-RPC消息包装为mcp消息发送给设备
+func (h *ConnectionHandler) sendMCPMessage(payload json.RawMessage) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"type":       "mcp",
+		"session_id": h.sessionID,
+		"payload":    payload,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化MCP消息失败: %v", err)
+	}
+	return h.conn.WriteMessage(1, data)
+}
+
+// handleDeviceMCPMessage 在读取协程中直接处理设备的mcp消息
+// 设备工具调用发生在对话处理中，若经过文本队列会被正在等待结果的对话阻塞
+func (h *ConnectionHandler) handleDeviceMCPMessage(message []byte) bool {
+	if !bytes.Contains(message, []byte(`"mcp"`)) {
+		return false
+	}
+	var msg struct {
+		Type    string          `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(message, &msg); err != nil || msg.Type != "mcp" {
+		return false
+	}
+
+	h.deviceMCPMu.Lock()
+	client := h.deviceMCP
+	h.deviceMCPMu.Unlock()
+	if client == nil {
+		h.logger.Warn("设备端MCP未初始化，忽略mcp消息")
+		return true
+	}
+	client.HandleMessage(msg.Payload)
+	return true
+}
+
+// replaceDeviceMCP 替换当前的设备端MCP，移除旧客户端注册的工具并关闭旧客户端
+func (h *ConnectionHandler) replaceDeviceMCP(client *mcp.Client) {
+	h.deviceMCPMu.Lock()
+	old := h.deviceMCP
+	names := h.deviceMCPTools
+	h.deviceMCP = client
+	h.deviceMCPTools = nil
+	h.deviceMCPMu.Unlock()
+
+	for _, name := range names {
+		h.UnregisterFunction(name)
+	}
+	if old != nil {
+		old.Close()
+	}
+}
+
+// removeDeviceMCP 初始化失败时移除设备端MCP，已被新客户端替换时不做处理
+func (h *ConnectionHandler) removeDeviceMCP(client *mcp.Client) {
+	h.deviceMCPMu.Lock()
+	current := h.deviceMCP == client
+	h.deviceMCPMu.Unlock()
+	if current {
+		h.replaceDeviceMCP(nil)
+	} else {
+		client.Close()
+	}
+}
+
+// closeDeviceMCP 关闭设备端MCP并移除设备工具，等待中的工具调用立即返回
+func (h *ConnectionHandler) closeDeviceMCP() {
+	h.replaceDeviceMCP(nil)
+}
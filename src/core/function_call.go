@@ -0,0 +1,125 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"xiaozhi-server-go/src/core/tools"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/google/uuid"
+)
+
+// maxFunctionCallRounds 单次对话中LLM连续调用函数的最大轮数，超过后不再提供函数，强制LLM直接回复
+const maxFunctionCallRounds = 5
+
+// RegisterFunction 为当前会话注册可供LLM调用的函数，同名函数会被覆盖
+func (h *ConnectionHandler) RegisterFunction(tool *tools.Tool) {
+	h.functionsMu.Lock()
+	defer h.functionsMu.Unlock()
+	h.functions[tool.Function.Name] = tool
+}
+
+// UnregisterFunction 移除当前会话的函数
+func (h *ConnectionHandler) UnregisterFunction(name string) {
+	h.functionsMu.Lock()
+	defer h.functionsMu.Unlock()
+	delete(h.functions, name)
+}
+
+// registerTools 注册配置中启用的服务端工具
+func (h *ConnectionHandler) registerTools(names []string) {
+	enabled, err := tools.Resolve(names)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("加载工具失败: %v", err))
+		return
+	}
+	for _, tool := range enabled {
+		h.RegisterFunction(tool)
+	}
+}
+
+// getFunctions 获取当前会话所有函数定义，按名称排序保证每次请求一致
+func (h *ConnectionHandler) getFunctions() []types.Function {
+	h.functionsMu.RLock()
+	defer h.functionsMu.RUnlock()
+
+	functions := make([]types.Function, 0, len(h.functions))
+	for _, tool := range h.functions {
+		functions = append(functions, tool.Function)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].Name < functions[j].Name
+	})
+	return functions
+}
+
+// executeFunction 执行LLM请求的函数调用，错误信息同样返回给LLM，由LLM决定如何回复用户
+func (h *ConnectionHandler) executeFunction(ctx context.Context, call types.ToolCall) *tools.Result {
+	h.functionsMu.RLock()
+	tool, ok := h.functions[call.Function.Name]
+	h.functionsMu.RUnlock()
+	if !ok {
+		h.logger.Warn(fmt.Sprintf("LLM调用了不存在的函数: %s", call.Function.Name))
+		return tools.NewTextResult(fmt.Sprintf("函数%s不存在", call.Function.Name))
+	}
+
+	h.logger.Info(fmt.Sprintf("执行函数调用: %s(%s)", call.Function.Name, call.Function.Arguments))
+	result, err := tool.Call(ctx, call.Function.Arguments)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("函数%s执行失败: %v", call.Function.Name, err))
+		return tools.NewTextResult(fmt.Sprintf("函数执行失败: %v", err))
+	}
+	return result
+}
+
+// mergeToolCalls 合并流式返回的工具调用分片
+// 同一调用的分片index相同，只有第一个分片带有ID和函数名，参数需要依次拼接
+func mergeToolCalls(calls []types.ToolCall, deltas []types.ToolCall) []types.ToolCall {
+	for _, delta := range deltas {
+		pos := -1
+		for i := range calls {
+			if calls[i].Index == delta.Index {
+				pos = i
+			}
+		}
+		// 部分模型一次返回多个完整调用且不带index，用ID区分
+		if pos < 0 || (delta.ID != "" && calls[pos].ID != "" && calls[pos].ID != delta.ID) {
+			calls = append(calls, types.ToolCall{Index: delta.Index})
+			pos = len(calls) - 1
+		}
+
+		call := &calls[pos]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		if delta.Function.Name != "" {
+			call.Function.Name = delta.Function.Name
+		}
+		call.Function.Arguments += delta.Function.Arguments
+	}
+	return calls
+}
+
+// completeToolCalls 过滤无效的调用并补全缺失的ID和类型
+func completeToolCalls(calls []types.ToolCall) []types.ToolCall {
+	result := make([]types.ToolCall, 0, len(calls))
+	for _, call := range calls {
+		if call.Function.Name == "" {
+			continue
+		}
+		if call.ID == "" {
+			call.ID = "call_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:16]
+		}
+		if call.Type == "" {
+			call.Type = "function"
+		}
+		result = append(result, call)
+	}
+	return result
+}
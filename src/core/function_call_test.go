@@ -0,0 +1,74 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"xiaozhi-server-go/src/core/types"
+)
+
+func toolCall(index int, id, name, args string) types.ToolCall {
+	call := types.ToolCall{Index: index, ID: id}
+	call.Function.Name = name
+	call.Function.Arguments = args
+	return call
+}
+
+func TestMergeToolCalls(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks [][]types.ToolCall
+		want   []types.ToolCall
+	}{
+		{
+			name: "分片参数依次拼接",
+			chunks: [][]types.ToolCall{
+				{toolCall(0, "call_1", "get_weather", "")},
+				{toolCall(0, "", "", `{"city":`)},
+				{toolCall(0, "", "", `"北京"}`)},
+			},
+			want: []types.ToolCall{toolCall(0, "call_1", "get_weather", `{"city":"北京"}`)},
+		},
+		{
+			name: "不同index的并行调用",
+			chunks: [][]types.ToolCall{
+				{toolCall(0, "call_1", "a", "{}"), toolCall(1, "call_2", "b", "")},
+				{toolCall(1, "", "", "{}")},
+			},
+			want: []types.ToolCall{toolCall(0, "call_1", "a", "{}"), toolCall(1, "call_2", "b", "{}")},
+		},
+		{
+			name: "不带index的多个完整调用按ID区分",
+			chunks: [][]types.ToolCall{
+				{toolCall(0, "call_1", "a", "{}")},
+				{toolCall(0, "call_2", "b", "{}")},
+			},
+			want: []types.ToolCall{toolCall(0, "call_1", "a", "{}"), toolCall(0, "call_2", "b", "{}")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []types.ToolCall
+			for _, chunk := range tt.chunks {
+				calls = mergeToolCalls(calls, chunk)
+			}
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("mergeToolCalls() = %+v, want %+v", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompleteToolCalls(t *testing.T) {
+	calls := completeToolCalls([]types.ToolCall{
+		toolCall(0, "", "", "{}"),
+		toolCall(1, "", "get_current_time", ""),
+	})
+	if len(calls) != 1 {
+		t.Fatalf("completeToolCalls() = %+v, want one call", calls)
+	}
+	if !strings.HasPrefix(calls[0].ID, "call_") || calls[0].Type != "function" {
+		t.Errorf("completeToolCalls() = %+v, want generated ID and function type", calls[0])
+	}
+}
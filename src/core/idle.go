@@ -0,0 +1,81 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// idleCheckInterval 空闲检测间隔
+const idleCheckInterval = time.Second
+
+// touchActivity 记录一次交互，服务端播放语音也算作交互
+func (h *ConnectionHandler) touchActivity() {
+	atomic.StoreInt64(&h.lastActivity, time.Now().UnixNano())
+}
+
+// touchUserActivity 记录一次用户交互，同时撤销空闲提醒
+func (h *ConnectionHandler) touchUserActivity() {
+	h.touchActivity()
+	atomic.StoreInt32(&h.idlePrompted, 0)
+}
+
+// idleDuration 距离最近一次交互的时间
+func (h *ConnectionHandler) idleDuration() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&h.lastActivity)))
+}
+
+// checkIdleCoroutine 检测空闲会话
+// 无交互超过idle.timeout后提醒用户，提醒后再无交互超过idle.close_after则告别并断开连接
+func (h *ConnectionHandler) checkIdleCoroutine() {
+	timeout := time.Duration(h.config.Idle.Timeout) * time.Second
+	if timeout <= 0 {
+		return
+	}
+	closeAfter := time.Duration(h.config.Idle.CloseAfter) * time.Second
+
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stopChan:
+			return
+		case <-ticker.C:
+			if atomic.LoadInt32(&h.closeAfterChat) == 1 {
+				// 已在告别流程中，由告别语播放结束或超时关闭连接
+				continue
+			}
+
+			idle := h.idleDuration()
+			if atomic.LoadInt32(&h.idlePrompted) == 0 {
+				if idle < timeout {
+					continue
+				}
+				if h.config.Idle.Prompt != "" && closeAfter > 0 {
+					h.logger.Info(fmt.Sprintf("会话空闲%v，提醒用户", idle.Truncate(time.Second)))
+					atomic.StoreInt32(&h.idlePrompted, 1)
+					// 提醒语的播放会刷新交互时间，close_after从提醒播放结束开始计算
+					h.touchActivity()
+					ctx, turn := h.startTurn(context.Background())
+					if err := h.speakText(ctx, h.config.Idle.Prompt); err != nil {
+						h.logger.Error(fmt.Sprintf("播报空闲提醒失败: %v", err))
+					}
+					h.endTurn(turn)
+					continue
+				}
+			} else if idle < closeAfter {
+				continue
+			}
+
+			h.logger.Info(fmt.Sprintf("会话空闲%v，结束会话", idle.Truncate(time.Second)))
+			ctx, turn := h.startTurn(context.Background())
+			if err := h.sayGoodbye(ctx); err != nil {
+				h.logger.Error(fmt.Sprintf("播报告别语失败: %v", err))
+				h.Close()
+			}
+			h.endTurn(turn)
+		}
+	}
+}
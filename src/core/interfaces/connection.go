@@ -1,5 +1,7 @@
 package interfaces
 
+import "context"
+
 // Conn WebSocket连接接口
 type Conn interface {
 	ReadMessage() (messageType int, p []byte, err error)
@@ -9,6 +11,6 @@ type Conn interface {
 // ConnectionHandler 连接处理器接口
 type ConnectionHandler interface {
 	Handle(conn Conn)
-	SpeakAndPlay(text string, textIndex int) error
+	SpeakAndPlay(ctx context.Context, text string, textIndex int) error
 	Close()
 }
@@ -0,0 +1,227 @@
+package iot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"xiaozhi-server-go/src/core/tools"
+	"xiaozhi-server-go/src/core/types"
+)
+
+// Property 设备属性或方法参数描述
+type Property struct {
+	Description string `json:"description"`
+	Type        string `json:"type"`
+}
+
+// Method 设备方法描述
+type Method struct {
+	Description string              `json:"description"`
+	Parameters  map[string]Property `json:"parameters"`
+}
+
+// Thing 设备上报的IoT描述符
+type Thing struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Properties  map[string]Property `json:"properties"`
+	Methods     map[string]Method   `json:"methods"`
+}
+
+// Command 下发给设备的IoT指令
+type Command struct {
+	Name       string                 `json:"name"`
+	Method     string                 `json:"method"`
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+// SendFunc 发送IoT指令
+type SendFunc func(commands []Command) error
+
+// Model 单个会话的设备模型，保存设备描述符和最新上报的状态
+type Model struct {
+	things map[string]*Thing
+	states map[string]map[string]interface{}
+	mu     sync.RWMutex
+}
+
+// NewModel 创建设备模型
+func NewModel() *Model {
+	return &Model{
+		things: make(map[string]*Thing),
+		states: make(map[string]map[string]interface{}),
+	}
+}
+
+// UpdateDescriptors 解析设备描述符，返回本次新增或更新的设备
+func (m *Model) UpdateDescriptors(descriptors interface{}) ([]*Thing, error) {
+	var things []*Thing
+	if err := convert(descriptors, &things); err != nil {
+		return nil, fmt.Errorf("解析IoT描述符失败: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]*Thing, 0, len(things))
+	for _, thing := range things {
+		if thing == nil || thing.Name == "" {
+			continue
+		}
+		m.things[thing.Name] = thing
+		result = append(result, thing)
+	}
+	return result, nil
+}
+
+// UpdateStates 更新设备上报的状态
+func (m *Model) UpdateStates(states interface{}) error {
+	var list []struct {
+		Name  string                 `json:"name"`
+		State map[string]interface{} `json:"state"`
+	}
+	if err := convert(states, &list); err != nil {
+		return fmt.Errorf("解析IoT状态失败: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, item := range list {
+		if item.Name == "" {
+			continue
+		}
+		if m.states[item.Name] == nil {
+			m.states[item.Name] = make(map[string]interface{})
+		}
+		for k, v := range item.State {
+			m.states[item.Name][k] = v
+		}
+	}
+	return nil
+}
+
+// GetState 获取设备属性的最新状态
+func (m *Model) GetState(thing, property string) (interface{}, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.states[thing][property]
+	return value, ok
+}
+
+// States 返回所有设备最新状态的副本
+func (m *Model) States() map[string]map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	states := make(map[string]map[string]interface{}, len(m.states))
+	for thing, props := range m.states {
+		copied := make(map[string]interface{}, len(props))
+		for k, v := range props {
+			copied[k] = v
+		}
+		states[thing] = copied
+	}
+	return states
+}
+
+// Tools 为设备生成LLM函数
+// 每个方法生成一个 {设备}_{方法} 函数用于下发指令，每个属性生成一个 {设备}_get_{属性} 函数用于查询状态
+func (m *Model) Tools(thing *Thing, send SendFunc) []*tools.Tool {
+	result := make([]*tools.Tool, 0, len(thing.Methods)+len(thing.Properties))
+
+	for _, name := range sortedKeys(thing.Methods) {
+		result = append(result, m.methodTool(thing, name, send))
+	}
+	for _, name := range sortedKeys(thing.Properties) {
+		result = append(result, m.propertyTool(thing, name))
+	}
+	return result
+}
+
+func (m *Model) methodTool(thing *Thing, methodName string, send SendFunc) *tools.Tool {
+	method := thing.Methods[methodName]
+	properties := make(map[string]types.ParamSchema, len(method.Parameters))
+	required := make([]string, 0, len(method.Parameters))
+	for name, param := range method.Parameters {
+		properties[name] = types.ParamSchema{
+			Type:        paramType(param.Type),
+			Description: param.Description,
+		}
+		required = append(required, name)
+	}
+	sort.Strings(required)
+
+	thingName := thing.Name
+	return &tools.Tool{
+		Function: types.Function{
+			Name:        fmt.Sprintf("%s_%s", thingName, methodName),
+			Description: fmt.Sprintf("%s - %s", thing.Description, method.Description),
+			Parameters: types.FunctionParams{
+				Type:       "object",
+				Properties: properties,
+				Required:   required,
+			},
+		},
+		Execute: func(ctx context.Context, args map[string]interface{}) (*tools.Result, error) {
+			if err := send([]Command{{Name: thingName, Method: methodName, Parameters: args}}); err != nil {
+				return nil, err
+			}
+			return tools.NewTextResult(fmt.Sprintf("已向%s发送%s指令", thing.Description, method.Description)), nil
+		},
+	}
+}
+
+func (m *Model) propertyTool(thing *Thing, propertyName string) *tools.Tool {
+	property := thing.Properties[propertyName]
+	thingName := thing.Name
+	return &tools.Tool{
+		Function: types.Function{
+			Name:        fmt.Sprintf("%s_get_%s", thingName, propertyName),
+			Description: fmt.Sprintf("查询%s的%s", thing.Description, property.Description),
+			Parameters: types.FunctionParams{
+				Type:       "object",
+				Properties: map[string]types.ParamSchema{},
+			},
+		},
+		Execute: func(ctx context.Context, args map[string]interface{}) (*tools.Result, error) {
+			value, ok := m.GetState(thingName, propertyName)
+			if !ok {
+				return tools.NewTextResult(fmt.Sprintf("设备尚未上报%s", property.Description)), nil
+			}
+			return tools.NewTextResult(fmt.Sprintf("%s的%s为%v", thing.Description, property.Description, value)), nil
+		},
+	}
+}
+
+// paramType IoT描述符中的类型转换为JSON Schema类型
+func paramType(t string) string {
+	switch t {
+	case "number", "boolean", "string":
+		return t
+	case "int", "integer":
+		return "number"
+	case "bool":
+		return "boolean"
+	default:
+		return "string"
+	}
+}
+
+// convert 将json解码得到的通用结构转换为目标结构
+func convert(src interface{}, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
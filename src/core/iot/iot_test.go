@@ -0,0 +1,124 @@
+package iot
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const speakerDescriptor = `[{
+	"name": "Speaker",
+	"description": "扬声器",
+	"properties": {"volume": {"description": "当前音量值", "type": "number"}},
+	"methods": {
+		"SetVolume": {
+			"description": "设置音量",
+			"parameters": {"volume": {"description": "0到100之间的整数", "type": "int"}}
+		}
+	}
+}, {"name": ""}]`
+
+// decode 模拟从设备消息中解码得到的通用结构
+func decode(t *testing.T, data string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	return v
+}
+
+func TestUpdateDescriptorsAndTools(t *testing.T) {
+	m := NewModel()
+	things, err := m.UpdateDescriptors(decode(t, speakerDescriptor))
+	if err != nil {
+		t.Fatalf("UpdateDescriptors() error = %v", err)
+	}
+	if len(things) != 1 || things[0].Name != "Speaker" {
+		t.Fatalf("UpdateDescriptors() = %+v, want only Speaker", things)
+	}
+
+	var sent []Command
+	send := func(commands []Command) error {
+		sent = append(sent, commands...)
+		return nil
+	}
+	thingTools := m.Tools(things[0], send)
+
+	var names []string
+	for _, tool := range thingTools {
+		names = append(names, tool.Function.Name)
+	}
+	if want := []string{"Speaker_SetVolume", "Speaker_get_volume"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("Tools() names = %v, want %v", names, want)
+	}
+
+	setVolume := thingTools[0]
+	param := setVolume.Function.Parameters.Properties["volume"]
+	if param.Type != "number" {
+		t.Errorf("SetVolume volume type = %q, want number", param.Type)
+	}
+	if !reflect.DeepEqual(setVolume.Function.Parameters.Required, []string{"volume"}) {
+		t.Errorf("SetVolume required = %v, want [volume]", setVolume.Function.Parameters.Required)
+	}
+
+	args := map[string]interface{}{"volume": float64(30)}
+	if _, err := setVolume.Execute(context.Background(), args); err != nil {
+		t.Fatalf("SetVolume Execute() error = %v", err)
+	}
+	want := []Command{{Name: "Speaker", Method: "SetVolume", Parameters: args}}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent commands = %+v, want %+v", sent, want)
+	}
+
+	getVolume := thingTools[1]
+	result, err := getVolume.Execute(context.Background(), nil)
+	if err != nil || result.Content != "设备尚未上报当前音量值" {
+		t.Errorf("get_volume before state = %v, %v", result, err)
+	}
+
+	if err := m.UpdateStates(decode(t, `[{"name": "Speaker", "state": {"volume": 30}}]`)); err != nil {
+		t.Fatalf("UpdateStates() error = %v", err)
+	}
+	result, err = getVolume.Execute(context.Background(), nil)
+	if err != nil || result.Content != "扬声器的当前音量值为30" {
+		t.Errorf("get_volume after state = %v, %v", result, err)
+	}
+}
+
+func TestUpdateDescriptorsInvalid(t *testing.T) {
+	if _, err := NewModel().UpdateDescriptors(decode(t, `{"name": "Speaker"}`)); err == nil {
+		t.Error("UpdateDescriptors() with non-array descriptors should fail")
+	}
+}
+
+func TestStatesReturnsCopy(t *testing.T) {
+	m := NewModel()
+	if err := m.UpdateStates(decode(t, `[{"name": "Battery", "state": {"level": 80}}]`)); err != nil {
+		t.Fatalf("UpdateStates() error = %v", err)
+	}
+	states := m.States()
+	states["Battery"]["level"] = 0
+	if value, _ := m.GetState("Battery", "level"); value != float64(80) {
+		t.Errorf("GetState() after modifying copy = %v, want 80", value)
+	}
+}
+
+func TestParamType(t *testing.T) {
+	tests := map[string]string{
+		"number":  "number",
+		"int":     "number",
+		"integer": "number",
+		"bool":    "boolean",
+		"boolean": "boolean",
+		"string":  "string",
+		"":        "string",
+		"object":  "string",
+	}
+	for in, want := range tests {
+		if got := paramType(in); got != want {
+			t.Errorf("paramType(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// ErrClientClosed MCP连接已关闭
+var ErrClientClosed = errors.New("MCP连接已关闭")
+
+// transport MCP传输层，负责收发单条JSON-RPC消息
+type transport interface {
+	start(ctx context.Context) error
+	send(ctx context.Context, data []byte) error
+	messages() <-chan []byte // 传输层关闭后通道关闭
+	close() error
+}
+
+// Client MCP客户端
+type Client struct {
+	name        string
+	logger      *utils.Logger
+	transport   transport
+	callTimeout time.Duration // 工具调用超时
+
+	nextID  int64
+	pending map[string]chan *Response
+	mu      sync.Mutex
+	done    chan struct{}
+}
+
+func newClient(name string, logger *utils.Logger, t transport) *Client {
+	return &Client{
+		name:        name,
+		logger:      logger,
+		transport:   t,
+		callTimeout: defaultCallTimeout,
+		pending:     make(map[string]chan *Response),
+		done:        make(chan struct{}),
+	}
+}
+
+// Name 服务名称
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Start 建立连接并完成初始化握手
+func (c *Client) Start(ctx context.Context) error {
+	if err := c.transport.start(ctx); err != nil {
+		return err
+	}
+	go c.readLoop()
+
+	if _, err := c.request(ctx, "initialize", InitializeParams(nil)); err != nil {
+		c.Close()
+		return fmt.Errorf("MCP初始化失败: %v", err)
+	}
+	if err := c.notify(ctx, "notifications/initialized", nil); err != nil {
+		c.Close()
+		return fmt.Errorf("MCP初始化失败: %v", err)
+	}
+	return nil
+}
+
+// ListTools 获取服务端提供的全部工具
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		var params map[string]interface{}
+		if cursor != "" {
+			params = map[string]interface{}{"cursor": cursor}
+		}
+		raw, err := c.request(ctx, "tools/list", params)
+		if err != nil {
+			return nil, err
+		}
+		var result ListToolsResult
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return nil, fmt.Errorf("解析工具列表失败: %v", err)
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool 调用工具
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (*CallToolResult, error) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	raw, err := c.request(ctx, "tools/call", map[string]interface{}{
+		"name":      name,
+		"arguments": args,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result CallToolResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("解析工具调用结果失败: %v", err)
+	}
+	return &result, nil
+}
+
+// Close 关闭连接，等待中的请求全部返回错误
+func (c *Client) Close() error {
+	return c.transport.close()
+}
+
+// request 发送请求并等待对应ID的响应
+func (c *Client) request(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	id := atomic.AddInt64(&c.nextID, 1)
+	key := strconv.FormatInt(id, 10)
+	ch := make(chan *Response, 1)
+
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		return nil, ErrClientClosed
+	default:
+	}
+	c.pending[key] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, key)
+		c.mu.Unlock()
+	}()
+
+	data, err := json.Marshal(Request{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return nil, fmt.Errorf("序列化MCP请求失败: %v", err)
+	}
+	if err := c.transport.send(ctx, data); err != nil {
+		return nil, fmt.Errorf("发送MCP请求失败: %v", err)
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Result, nil
+	case <-c.done:
+		return nil, ErrClientClosed
+	case <-ctx.Done():
+		return nil, fmt.Errorf("MCP请求%s超时: %v", method, ctx.Err())
+	}
+}
+
+// notify 发送通知，不等待响应
+func (c *Client) notify(ctx context.Context, method string, params interface{}) error {
+	data, err := json.Marshal(Request{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return fmt.Errorf("序列化MCP通知失败: %v", err)
+	}
+	return c.transport.send(ctx, data)
+}
+
+// readLoop 分发服务端消息，传输层关闭后结束
+func (c *Client) readLoop() {
+	defer close(c.done)
+
+	for data := range c.transport.messages() {
+		var msg Response
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.logger.Warn(fmt.Sprintf("MCP服务%s消息解析失败: %v", c.name, err))
+			continue
+		}
+
+		if msg.Method != "" {
+			if len(msg.ID) > 0 {
+				c.replyServerRequest(&msg)
+			}
+			continue
+		}
+
+		// 取出后立即删除，重复或迟到的响应直接丢弃，不会阻塞读取
+		c.mu.Lock()
+		ch, ok := c.pending[string(msg.ID)]
+		delete(c.pending, string(msg.ID))
+		c.mu.Unlock()
+		if ok {
+			ch <- &msg
+		}
+	}
+}
+
+// replyServerRequest 响应服务端发起的请求，目前只支持ping，其他方法返回方法不存在
+func (c *Client) replyServerRequest(msg *Response) {
+	reply := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      msg.ID,
+	}
+	if msg.Method == "ping" {
+		reply["result"] = map[string]interface{}{}
+	} else {
+		reply["error"] = &RPCError{Code: -32601, Message: "Method not found: " + msg.Method}
+	}
+	data, _ := json.Marshal(reply)
+	if err := c.transport.send(context.Background(), data); err != nil {
+		c.logger.Warn(fmt.Sprintf("MCP服务%s响应请求%s失败: %v", c.name, msg.Method, err))
+	}
+}
@@ -0,0 +1,255 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// fakeServer 通过设备端传输模拟MCP服务端，客户端发出的消息放入sent
+type fakeServer struct {
+	t      *testing.T
+	client *Client
+	sent   chan *Response
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	config := &configs.Config{}
+	config.Log.LogDir = t.TempDir()
+	config.Log.LogFile = "test.log"
+	logger, err := utils.NewLogger(config)
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+
+	s := &fakeServer{t: t, sent: make(chan *Response, 16)}
+	s.client = NewDeviceClient("fake", func(payload json.RawMessage) error {
+		var msg Response
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			t.Errorf("客户端发送的消息无法解析: %s", payload)
+			return err
+		}
+		s.sent <- &msg
+		return nil
+	}, logger)
+	t.Cleanup(func() { s.client.Close() })
+	return s
+}
+
+// next 读取客户端发送的下一条消息
+func (s *fakeServer) next() *Response {
+	s.t.Helper()
+	select {
+	case msg := <-s.sent:
+		return msg
+	case <-time.After(time.Second):
+		s.t.Fatal("等待客户端消息超时")
+		return nil
+	}
+}
+
+// reply 向客户端返回响应
+func (s *fakeServer) reply(id json.RawMessage, result string) {
+	s.client.HandleMessage([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":%s}`, id, result)))
+}
+
+// start 完成初始化握手
+func (s *fakeServer) start() {
+	s.t.Helper()
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.client.Start(context.Background()) }()
+
+	init := s.next()
+	if init.Method != "initialize" {
+		s.t.Fatalf("第一条消息 = %s, want initialize", init.Method)
+	}
+	s.reply(init.ID, `{}`)
+	if msg := s.next(); msg.Method != "notifications/initialized" {
+		s.t.Fatalf("第二条消息 = %s, want notifications/initialized", msg.Method)
+	}
+	if err := <-errCh; err != nil {
+		s.t.Fatalf("Start() error = %v", err)
+	}
+}
+
+type callResult struct {
+	text string
+	err  error
+}
+
+// call 在后台调用工具，返回结果通道和客户端发出的请求
+func (s *fakeServer) call(ctx context.Context, name string) (chan callResult, *Response) {
+	s.t.Helper()
+	done := make(chan callResult, 1)
+	go func() {
+		result, err := s.client.CallTool(ctx, name, nil)
+		if err != nil {
+			done <- callResult{err: err}
+			return
+		}
+		done <- callResult{text: result.Text()}
+	}()
+	return done, s.next()
+}
+
+func toolResult(text string) string {
+	return fmt.Sprintf(`{"content":[{"type":"text","text":%q}]}`, text)
+}
+
+func wait(t *testing.T, done chan callResult) callResult {
+	t.Helper()
+	select {
+	case r := <-done:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("等待工具调用结果超时")
+		return callResult{}
+	}
+}
+
+func TestClientResponsesMatchedByID(t *testing.T) {
+	s := newFakeServer(t)
+	s.start()
+
+	first, firstReq := s.call(context.Background(), "a")
+	second, secondReq := s.call(context.Background(), "b")
+	if string(firstReq.ID) == string(secondReq.ID) {
+		t.Fatalf("两个请求的ID相同: %s", firstReq.ID)
+	}
+
+	// 按相反的顺序返回
+	s.reply(secondReq.ID, toolResult("b"))
+	s.reply(firstReq.ID, toolResult("a"))
+	if r := wait(t, first); r.err != nil || r.text != "a" {
+		t.Errorf("first call = %q, %v, want a", r.text, r.err)
+	}
+	if r := wait(t, second); r.err != nil || r.text != "b" {
+		t.Errorf("second call = %q, %v, want b", r.text, r.err)
+	}
+}
+
+func TestClientIgnoresDuplicateAndUnknownResponses(t *testing.T) {
+	s := newFakeServer(t)
+	s.start()
+
+	done, req := s.call(context.Background(), "a")
+	// 同一ID连续返回多次，以及未知ID的响应，都不能阻塞读取
+	s.reply(req.ID, toolResult("a"))
+	s.reply(req.ID, toolResult("duplicate"))
+	s.reply(req.ID, toolResult("duplicate"))
+	s.reply(json.RawMessage(`9999`), toolResult("unknown"))
+	if r := wait(t, done); r.err != nil || r.text != "a" {
+		t.Errorf("call = %q, %v, want a", r.text, r.err)
+	}
+
+	done, req = s.call(context.Background(), "b")
+	s.reply(req.ID, toolResult("b"))
+	if r := wait(t, done); r.err != nil || r.text != "b" {
+		t.Errorf("call after duplicates = %q, %v, want b", r.text, r.err)
+	}
+}
+
+func TestClientCallTimeout(t *testing.T) {
+	s := newFakeServer(t)
+	s.start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done, req := s.call(ctx, "slow")
+	r := wait(t, done)
+	if r.err == nil || !strings.Contains(r.err.Error(), "超时") {
+		t.Fatalf("call error = %v, want timeout", r.err)
+	}
+
+	s.client.mu.Lock()
+	pending := len(s.client.pending)
+	s.client.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("超时后仍有%d个等待中的请求", pending)
+	}
+
+	// 超时后才到达的响应被丢弃，后续调用不受影响
+	s.reply(req.ID, toolResult("late"))
+	done, req = s.call(context.Background(), "next")
+	s.reply(req.ID, toolResult("next"))
+	if r := wait(t, done); r.err != nil || r.text != "next" {
+		t.Errorf("call after timeout = %q, %v, want next", r.text, r.err)
+	}
+}
+
+func TestClientCallError(t *testing.T) {
+	s := newFakeServer(t)
+	s.start()
+
+	done, req := s.call(context.Background(), "a")
+	s.client.HandleMessage([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"error":{"code":-32602,"message":"bad params"}}`, req.ID)))
+	r := wait(t, done)
+	var rpcErr *RPCError
+	if !errors.As(r.err, &rpcErr) || rpcErr.Code != -32602 {
+		t.Errorf("call error = %v, want RPCError -32602", r.err)
+	}
+}
+
+func TestClientServerRequests(t *testing.T) {
+	s := newFakeServer(t)
+	s.start()
+
+	tests := []struct {
+		name      string
+		message   string
+		wantReply bool
+		wantError bool
+	}{
+		{"ping", `{"jsonrpc":"2.0","id":"srv-1","method":"ping"}`, true, false},
+		{"不支持的方法", `{"jsonrpc":"2.0","id":"srv-2","method":"sampling/createMessage"}`, true, true},
+		{"通知不回复", `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.client.HandleMessage([]byte(tt.message))
+			if !tt.wantReply {
+				select {
+				case msg := <-s.sent:
+					t.Errorf("通知收到回复: %+v", msg)
+				case <-time.After(50 * time.Millisecond):
+				}
+				return
+			}
+
+			var req Response
+			json.Unmarshal([]byte(tt.message), &req)
+			reply := s.next()
+			if string(reply.ID) != string(req.ID) {
+				t.Errorf("reply id = %s, want %s", reply.ID, req.ID)
+			}
+			if (reply.Error != nil) != tt.wantError {
+				t.Errorf("reply error = %v, wantError %v", reply.Error, tt.wantError)
+			}
+			if !tt.wantError && string(reply.Result) != "{}" {
+				t.Errorf("reply result = %s, want {}", reply.Result)
+			}
+		})
+	}
+}
+
+func TestClientCloseFailsPendingCalls(t *testing.T) {
+	s := newFakeServer(t)
+	s.start()
+
+	done, _ := s.call(context.Background(), "a")
+	s.client.Close()
+	if r := wait(t, done); r.err != ErrClientClosed {
+		t.Errorf("call error after Close = %v, want %v", r.err, ErrClientClosed)
+	}
+	if _, err := s.client.CallTool(context.Background(), "b", nil); err != ErrClientClosed {
+		t.Errorf("CallTool() after Close error = %v, want %v", err, ErrClientClosed)
+	}
+}
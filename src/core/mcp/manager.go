@@ -0,0 +1,159 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/tools"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const (
+	defaultConnectTimeout = 30 * time.Second
+	defaultCallTimeout    = 30 * time.Second
+)
+
+// Manager 管理配置中的所有外部MCP服务
+// 服务端启动时连接各MCP服务并拉取工具列表，所有会话共享这些连接
+type Manager struct {
+	config  *configs.Config
+	logger  *utils.Logger
+	clients []*Client
+	tools   []*tools.Tool
+	closed  bool
+	mu      sync.RWMutex
+}
+
+// NewManager 创建MCP服务管理器
+func NewManager(config *configs.Config, logger *utils.Logger) *Manager {
+	return &Manager{config: config, logger: logger}
+}
+
+// Start 连接所有MCP服务，单个服务失败不影响其他服务
+func (m *Manager) Start(ctx context.Context) {
+	for name, server := range m.config.MCP.Servers {
+		if server.Disabled {
+			continue
+		}
+
+		var client *Client
+		switch {
+		case server.Command != "":
+			client = NewStdioClient(name, server.Command, server.Args, server.Env, m.logger)
+		case server.URL != "":
+			client = NewSSEClient(name, server.URL, server.Headers, m.logger)
+		default:
+			m.logger.Error(fmt.Sprintf("MCP服务%s缺少command或url配置", name))
+			continue
+		}
+
+		if err := m.connect(ctx, client); err != nil {
+			m.logger.Error(fmt.Sprintf("连接MCP服务%s失败: %v", name, err))
+			client.Close()
+			continue
+		}
+	}
+}
+
+// connect 初始化MCP服务并把其工具转换为服务端工具
+func (m *Manager) connect(ctx context.Context, client *Client) error {
+	connectCtx, cancel := context.WithTimeout(ctx, defaultConnectTimeout)
+	defer cancel()
+
+	if err := client.Start(connectCtx); err != nil {
+		return err
+	}
+	mcpTools, err := client.ListTools(connectCtx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClientClosed
+	}
+	m.clients = append(m.clients, client)
+	for _, t := range mcpTools {
+		if m.hasTool(FunctionName(t.Name)) {
+			m.logger.Warn(fmt.Sprintf("MCP工具%s重名，忽略服务%s提供的同名工具", t.Name, client.Name()))
+			continue
+		}
+		m.tools = append(m.tools, NewTool(client, t))
+	}
+	m.logger.Info(fmt.Sprintf("MCP服务%s已连接，工具数: %d", client.Name(), len(mcpTools)))
+	return nil
+}
+
+// hasTool 调用方需持有锁
+func (m *Manager) hasTool(name string) bool {
+	for _, t := range m.tools {
+		if t.Function.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Tools 返回所有MCP工具
+func (m *Manager) Tools() []*tools.Tool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]*tools.Tool, len(m.tools))
+	copy(result, m.tools)
+	return result
+}
+
+// Close 断开所有MCP服务
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, client := range m.clients {
+		if err := client.Close(); err != nil {
+			m.logger.Error(fmt.Sprintf("关闭MCP服务%s失败: %v", client.Name(), err))
+		}
+	}
+	m.clients = nil
+	m.tools = nil
+	m.closed = true
+}
+
+// NewTool 将MCP工具包装为服务端工具，调用结果交给LLM处理
+// 函数名中不允许出现的字符替换为下划线，调用时仍使用原始工具名
+func NewTool(client *Client, t Tool) *tools.Tool {
+	name := t.Name
+	return &tools.Tool{
+		Function: t.ToFunction(FunctionName(name)),
+		Execute: func(ctx context.Context, args map[string]interface{}) (*tools.Result, error) {
+			callCtx, cancel := context.WithTimeout(ctx, client.callTimeout)
+			defer cancel()
+
+			result, err := client.CallTool(callCtx, name, args)
+			if err != nil {
+				return nil, err
+			}
+			if result.IsError {
+				return tools.NewTextResult("工具执行出错: " + result.Text()), nil
+			}
+			return tools.NewTextResult(result.Text()), nil
+		},
+	}
+}
+
+// FunctionName 将MCP工具名转换为LLM允许的函数名(字母、数字、下划线和中划线)
+func FunctionName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,160 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"xiaozhi-server-go/src/core/types"
+)
+
+// ProtocolVersion 客户端使用的MCP协议版本
+const ProtocolVersion = "2024-11-05"
+
+// Request JSON-RPC请求，ID为空时是通知
+type Request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      interface{} `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// Response JSON-RPC响应，服务端主动发起的请求和通知也按该结构解析
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// RPCError JSON-RPC错误
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("MCP错误(%d): %s", e.Code, e.Message)
+}
+
+// Tool MCP服务端提供的工具
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// ListToolsResult tools/list 返回结果
+type ListToolsResult struct {
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// Content 工具返回的内容块
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// CallToolResult tools/call 返回结果
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// Text 拼接结果中的文本内容，非文本内容只保留类型说明
+func (r *CallToolResult) Text() string {
+	parts := make([]string, 0, len(r.Content))
+	for _, c := range r.Content {
+		if c.Type == "text" {
+			parts = append(parts, c.Text)
+		} else {
+			parts = append(parts, fmt.Sprintf("[%s内容]", c.Type))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// InitializeParams initialize 请求参数
+func InitializeParams(capabilities map[string]interface{}) map[string]interface{} {
+	if capabilities == nil {
+		capabilities = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    capabilities,
+		"clientInfo": map[string]interface{}{
+			"name":    "xiaozhi-server-go",
+			"version": "1.0.0",
+		},
+	}
+}
+
+// schemaProperty JSON Schema中的属性，type可能是字符串或字符串数组
+type schemaProperty struct {
+	Type        interface{}     `json:"type"`
+	Description string          `json:"description"`
+	Enum        []interface{}   `json:"enum"`
+	Items       *schemaProperty `json:"items"`
+}
+
+// ToFunction 将MCP工具定义转换为LLM函数定义
+func (t Tool) ToFunction(name string) types.Function {
+	var schema struct {
+		Properties map[string]*schemaProperty `json:"properties"`
+		Required   []string                   `json:"required"`
+	}
+	if len(t.InputSchema) > 0 {
+		_ = json.Unmarshal(t.InputSchema, &schema)
+	}
+
+	properties := make(map[string]types.ParamSchema, len(schema.Properties))
+	for key, prop := range schema.Properties {
+		if prop != nil {
+			properties[key] = *prop.toParamSchema()
+		}
+	}
+	return types.Function{
+		Name:        name,
+		Description: t.Description,
+		Parameters: types.FunctionParams{
+			Type:       "object",
+			Properties: properties,
+			Required:   schema.Required,
+		},
+	}
+}
+
+func (p *schemaProperty) toParamSchema() *types.ParamSchema {
+	result := &types.ParamSchema{
+		Type:        "string",
+		Description: p.Description,
+	}
+	switch v := p.Type.(type) {
+	case string:
+		result.Type = v
+	case []interface{}:
+		// 形如 ["string", "null"]，取第一个非null类型
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "null" {
+				result.Type = s
+				break
+			}
+		}
+	}
+	switch result.Type {
+	case "string":
+		for _, e := range p.Enum {
+			result.Enum = append(result.Enum, fmt.Sprint(e))
+		}
+	case "array":
+		if p.Items != nil {
+			result.Items = p.Items.toParamSchema()
+		} else {
+			result.Items = &types.ParamSchema{Type: "string"}
+		}
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// deviceCallTimeout 设备端工具调用超时，设备离线或无响应时尽快返回给LLM
+const deviceCallTimeout = 10 * time.Second
+
+// SendFunc 向设备发送MCP消息，payload为JSON-RPC消息体
+type SendFunc func(payload json.RawMessage) error
+
+// deviceTransport 设备端MCP传输
+// JSON-RPC消息包装在 {"type":"mcp","payload":{...}} 中通过设备连接收发
+type deviceTransport struct {
+	sendFunc SendFunc
+	incoming chan []byte
+	closed   bool
+	mu       sync.Mutex
+}
+
+// NewDeviceClient 创建与设备通信的MCP客户端，设备上报的mcp消息需通过HandleMessage传入
+func NewDeviceClient(name string, send SendFunc, logger *utils.Logger) *Client {
+	c := newClient(name, logger, &deviceTransport{
+		sendFunc: send,
+		incoming: make(chan []byte, 16),
+	})
+	c.callTimeout = deviceCallTimeout
+	return c
+}
+
+// HandleMessage 传入设备上报的MCP消息，仅用于设备端客户端
+func (c *Client) HandleMessage(payload []byte) {
+	if t, ok := c.transport.(*deviceTransport); ok {
+		t.push(payload)
+	}
+}
+
+func (t *deviceTransport) start(ctx context.Context) error {
+	return nil
+}
+
+func (t *deviceTransport) send(ctx context.Context, data []byte) error {
+	t.mu.Lock()
+	closed := t.closed
+	t.mu.Unlock()
+	if closed {
+		return ErrClientClosed
+	}
+	return t.sendFunc(data)
+}
+
+// push 放入设备消息，队列满时丢弃，避免阻塞设备连接的读取
+func (t *deviceTransport) push(data []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.incoming <- data:
+	default:
+	}
+}
+
+func (t *deviceTransport) messages() <-chan []byte {
+	return t.incoming
+}
+
+func (t *deviceTransport) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.incoming)
+	}
+	return nil
+}
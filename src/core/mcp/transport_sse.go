@@ -0,0 +1,177 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// sseTransport HTTP+SSE传输
+// 客户端以GET建立SSE长连接，服务端先通过endpoint事件下发消息提交地址，之后的响应通过message事件推送
+type sseTransport struct {
+	name    string
+	url     string
+	headers map[string]string
+	logger  *utils.Logger
+	client  *http.Client
+
+	endpoint  string
+	incoming  chan []byte
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+// NewSSEClient 创建通过HTTP SSE通信的MCP客户端
+func NewSSEClient(name, serverURL string, headers map[string]string, logger *utils.Logger) *Client {
+	return newClient(name, logger, &sseTransport{
+		name:     name,
+		url:      serverURL,
+		headers:  headers,
+		logger:   logger,
+		client:   &http.Client{},
+		incoming: make(chan []byte, 16),
+	})
+}
+
+func (t *sseTransport) start(ctx context.Context) error {
+	streamCtx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, t.url, nil)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("创建SSE请求失败: %v", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	t.setHeaders(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("连接MCP SSE服务失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return fmt.Errorf("连接MCP SSE服务失败: 状态码%d", resp.StatusCode)
+	}
+
+	endpointCh := make(chan string, 1)
+	go t.readEvents(resp.Body, endpointCh)
+
+	select {
+	case endpoint, ok := <-endpointCh:
+		if !ok {
+			cancel()
+			return fmt.Errorf("MCP SSE连接在下发endpoint前关闭")
+		}
+		t.endpoint = endpoint
+		return nil
+	case <-ctx.Done():
+		cancel()
+		return fmt.Errorf("等待MCP SSE endpoint超时: %v", ctx.Err())
+	}
+}
+
+// readEvents 解析SSE事件流
+func (t *sseTransport) readEvents(body io.ReadCloser, endpointCh chan<- string) {
+	defer body.Close()
+	defer close(t.incoming)
+
+	endpointSent := false
+	defer func() {
+		if !endpointSent {
+			close(endpointCh)
+		}
+	}()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	event := ""
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// 空行表示一个事件结束
+			payload := strings.Join(data, "\n")
+			if event == "endpoint" && !endpointSent {
+				endpoint, err := t.resolveEndpoint(payload)
+				if err != nil {
+					t.logger.Error(fmt.Sprintf("MCP服务%s endpoint无效: %v", t.name, err))
+					return
+				}
+				endpointCh <- endpoint
+				endpointSent = true
+			} else if (event == "" || event == "message") && payload != "" {
+				t.incoming <- []byte(payload)
+			}
+			event = ""
+			data = data[:0]
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
+
+// resolveEndpoint endpoint可能是相对路径，需要基于SSE地址补全
+func (t *sseTransport) resolveEndpoint(endpoint string) (string, error) {
+	base, err := url.Parse(t.url)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(strings.TrimSpace(endpoint))
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+func (t *sseTransport) send(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	t.setHeaders(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("状态码%d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (t *sseTransport) setHeaders(req *http.Request) {
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+}
+
+func (t *sseTransport) messages() <-chan []byte {
+	return t.incoming
+}
+
+func (t *sseTransport) close() error {
+	t.closeOnce.Do(func() {
+		if t.cancel != nil {
+			t.cancel()
+		}
+	})
+	return nil
+}
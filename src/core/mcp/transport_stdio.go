@@ -0,0 +1,121 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// stdioTransport 启动本地进程，通过标准输入输出按行收发JSON-RPC消息
+type stdioTransport struct {
+	name    string
+	command string
+	args    []string
+	env     map[string]string
+	logger  *utils.Logger
+
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	incoming  chan []byte
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+}
+
+// NewStdioClient 创建通过子进程标准输入输出通信的MCP客户端
+func NewStdioClient(name, command string, args []string, env map[string]string, logger *utils.Logger) *Client {
+	return newClient(name, logger, &stdioTransport{
+		name:     name,
+		command:  command,
+		args:     args,
+		env:      env,
+		logger:   logger,
+		incoming: make(chan []byte, 16),
+	})
+}
+
+func (t *stdioTransport) start(ctx context.Context) error {
+	cmd := exec.Command(t.command, t.args...)
+	cmd.Env = os.Environ()
+	for k, v := range t.env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("创建MCP进程输入管道失败: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("创建MCP进程输出管道失败: %v", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("创建MCP进程错误输出管道失败: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("启动MCP进程失败: %v", err)
+	}
+	t.cmd = cmd
+	t.stdin = stdin
+
+	go func() {
+		defer close(t.incoming)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			data := make([]byte, len(line))
+			copy(data, line)
+			t.incoming <- data
+		}
+		cmd.Wait()
+		t.logger.Info(fmt.Sprintf("MCP服务%s进程已退出", t.name))
+	}()
+
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			t.logger.Debug(fmt.Sprintf("MCP服务%s: %s", t.name, scanner.Text()))
+		}
+	}()
+	return nil
+}
+
+func (t *stdioTransport) send(ctx context.Context, data []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if t.stdin == nil {
+		return ErrClientClosed
+	}
+	_, err := t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) messages() <-chan []byte {
+	return t.incoming
+}
+
+// close 关闭输入管道并结束进程，进程由读协程回收
+func (t *stdioTransport) close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		t.writeMu.Lock()
+		if t.stdin != nil {
+			err = t.stdin.Close()
+		}
+		t.writeMu.Unlock()
+		if t.cmd != nil && t.cmd.Process != nil {
+			t.cmd.Process.Kill()
+		}
+	})
+	return err
+}
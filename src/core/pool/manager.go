@@ -0,0 +1,385 @@
+package pool
+
+import (
+	"fmt"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/asr"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/providers/tts"
+	"xiaozhi-server-go/src/core/providers/vad"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const (
+	defaultPoolMinSize = 2
+	defaultPoolMaxSize = 20
+)
+
+// ProviderSet 单个会话使用的一组服务提供者
+type ProviderSet struct {
+	ASR providers.ASRProvider
+	LLM providers.LLMProvider
+	TTS providers.TTSProvider
+	VAD providers.VADProvider // 未配置VAD时为nil
+
+	ttsPool *ResourcePool // TTS实例所属的资源池
+}
+
+// ttsKey TTS资源池的索引，同一TTS配置的不同音色使用不同的资源池
+type ttsKey struct {
+	name  string
+	voice string
+}
+
+// PoolManager 服务提供者资源池管理器
+// ASR和TTS是有状态的，每个会话独占一个实例；LLM无状态，所有会话共享同一实例
+// VAD为纯本地计算，创建开销很小，每个会话直接新建
+// 智能体可以指定不同的LLM、TTS和音色，启动时为每种组合分别创建实例或资源池
+type PoolManager struct {
+	logger     *utils.Logger
+	config     *configs.Config
+	asrPool    *ResourcePool
+	ttsPools   map[ttsKey]*ResourcePool
+	llms       map[string]providers.LLMProvider
+	defaultLLM string
+	defaultTTS string
+	vadConfig  *configs.VADConfig
+	minSize    int
+	maxSize    int
+}
+
+// NewPoolManager 根据配置创建资源池管理器
+func NewPoolManager(config *configs.Config, logger *utils.Logger) (*PoolManager, error) {
+	logger.Info("开始初始化服务提供者资源池...")
+	selectedModule := config.SelectedModule
+
+	// 检查必要的模块配置是否存在
+	requiredModules := []string{"ASR", "LLM", "TTS"}
+	for _, module := range requiredModules {
+		if name, ok := selectedModule[module]; !ok || name == "" {
+			logger.Error(fmt.Sprintf("配置文件中缺少必要的模块配置: %s", module))
+			return nil, fmt.Errorf("配置文件中缺少必要的模块配置: %s", module)
+		}
+	}
+
+	// 未配置资源池时使用默认值
+	minSize, maxSize := config.Pool.MinSize, config.Pool.MaxSize
+	if maxSize <= 0 {
+		minSize, maxSize = defaultPoolMinSize, defaultPoolMaxSize
+	}
+
+	pm := &PoolManager{
+		logger:     logger,
+		config:     config,
+		ttsPools:   make(map[ttsKey]*ResourcePool),
+		llms:       make(map[string]providers.LLMProvider),
+		defaultLLM: selectedModule["LLM"],
+		defaultTTS: selectedModule["TTS"],
+		minSize:    minSize,
+		maxSize:    maxSize,
+	}
+
+	// 初始化默认LLM和智能体使用的LLM（共享实例）
+	if err := pm.initLLM(pm.defaultLLM); err != nil {
+		pm.Close()
+		return nil, err
+	}
+	for _, agent := range config.Agents.Profiles {
+		if err := pm.initLLM(agent.LLM); err != nil {
+			pm.Close()
+			return nil, err
+		}
+	}
+
+	// VAD为可选模块
+	if vadName := selectedModule["VAD"]; vadName != "" {
+		vadCfg, ok := config.VAD[vadName]
+		if !ok {
+			pm.Close()
+			return nil, fmt.Errorf("找不到VAD配置: %s", vadName)
+		}
+		// 提前创建一次，尽早暴露配置错误
+		if _, err := newVAD(&vadCfg); err != nil {
+			pm.Close()
+			return nil, fmt.Errorf("初始化VAD失败: %v", err)
+		}
+		logger.Info(fmt.Sprintf("已启用本地VAD(%s)", vadName))
+		pm.vadConfig = &vadCfg
+	}
+
+	// 初始化ASR资源池
+	asrName := selectedModule["ASR"]
+	asrCfg, ok := config.ASR[asrName]
+	if !ok {
+		pm.Close()
+		return nil, fmt.Errorf("找不到ASR配置: %s", asrName)
+	}
+	logger.Info(fmt.Sprintf("正在初始化ASR资源池(%s)...", asrName))
+	var err error
+	pm.asrPool, err = NewResourcePool("ASR", &asrFactory{
+		config:      asrCfg,
+		deleteAudio: config.DeleteAudio,
+	}, minSize, maxSize)
+	if err != nil {
+		pm.Close()
+		return nil, fmt.Errorf("初始化ASR资源池失败: %v", err)
+	}
+
+	// 初始化默认TTS和智能体使用的TTS资源池
+	if err := pm.initTTSPool(pm.defaultTTS, ""); err != nil {
+		pm.Close()
+		return nil, err
+	}
+	for _, agent := range config.Agents.Profiles {
+		if err := pm.initTTSPool(agent.TTS, agent.Voice); err != nil {
+			pm.Close()
+			return nil, err
+		}
+	}
+
+	logger.Info(fmt.Sprintf("服务提供者资源池初始化成功 (预创建: %d, 最大空闲: %d)", minSize, maxSize))
+	return pm, nil
+}
+
+// initLLM 创建指定名称的LLM实例，名称为空或已创建时直接返回
+func (pm *PoolManager) initLLM(name string) error {
+	if name == "" || pm.llms[name] != nil {
+		return nil
+	}
+	llmCfg, ok := pm.config.LLM[name]
+	if !ok {
+		return fmt.Errorf("找不到LLM配置: %s", name)
+	}
+	pm.logger.Info(fmt.Sprintf("正在初始化LLM服务(%s)...", name))
+	llmProvider, err := llm.Create(llmCfg.Type, &llm.Config{
+		Type:        llmCfg.Type,
+		ModelName:   llmCfg.ModelName,
+		BaseURL:     llmCfg.BaseURL,
+		APIKey:      llmCfg.APIKey,
+		Temperature: llmCfg.Temperature,
+		MaxTokens:   llmCfg.MaxTokens,
+		TopP:        llmCfg.TopP,
+		Extra:       llmCfg.Extra,
+	})
+	if err != nil {
+		return fmt.Errorf("初始化LLM失败: %v", err)
+	}
+	pm.llms[name] = llmProvider
+	return nil
+}
+
+// initTTSPool 创建指定TTS配置和音色的资源池，已创建时直接返回
+func (pm *PoolManager) initTTSPool(name, voice string) error {
+	key, err := pm.ttsKey(name, voice)
+	if err != nil {
+		return err
+	}
+	if pm.ttsPools[key] != nil {
+		return nil
+	}
+	ttsCfg := pm.config.TTS[key.name]
+	ttsCfg.Voice = key.voice
+	pm.logger.Info(fmt.Sprintf("正在初始化TTS资源池(%s, 音色: %s)...", key.name, key.voice))
+	pool, err := NewResourcePool("TTS", &ttsFactory{
+		config:      ttsCfg,
+		deleteAudio: pm.config.DeleteAudio,
+	}, pm.minSize, pm.maxSize)
+	if err != nil {
+		return fmt.Errorf("初始化TTS资源池失败: %v", err)
+	}
+	pm.ttsPools[key] = pool
+	return nil
+}
+
+// ttsKey 补全TTS配置名和音色，为空时分别使用默认TTS和该TTS配置中的音色
+func (pm *PoolManager) ttsKey(name, voice string) (ttsKey, error) {
+	if name == "" {
+		name = pm.defaultTTS
+	}
+	ttsCfg, ok := pm.config.TTS[name]
+	if !ok {
+		return ttsKey{}, fmt.Errorf("找不到TTS配置: %s", name)
+	}
+	if voice == "" {
+		voice = ttsCfg.Voice
+	}
+	return ttsKey{name: name, voice: voice}, nil
+}
+
+// GetProviderSet 为新会话获取一组服务提供者
+// llmName、ttsName和voice为空时使用selected_module中的模块和TTS配置中的音色
+func (pm *PoolManager) GetProviderSet(llmName, ttsName, voice string) (*ProviderSet, error) {
+	if llmName == "" {
+		llmName = pm.defaultLLM
+	}
+	llmProvider, ok := pm.llms[llmName]
+	if !ok {
+		return nil, fmt.Errorf("LLM未初始化: %s", llmName)
+	}
+	key, err := pm.ttsKey(ttsName, voice)
+	if err != nil {
+		return nil, err
+	}
+	ttsPool, ok := pm.ttsPools[key]
+	if !ok {
+		return nil, fmt.Errorf("TTS资源池未初始化: %s(%s)", key.name, key.voice)
+	}
+
+	asrRes, err := pm.asrPool.Get()
+	if err != nil {
+		return nil, err
+	}
+	ttsRes, err := ttsPool.Get()
+	if err != nil {
+		pm.asrPool.Put(asrRes)
+		return nil, err
+	}
+
+	set := &ProviderSet{
+		ASR:     asrRes.(providers.ASRProvider),
+		LLM:     llmProvider,
+		TTS:     ttsRes.(providers.TTSProvider),
+		ttsPool: ttsPool,
+	}
+	if pm.vadConfig != nil {
+		if set.VAD, err = newVAD(pm.vadConfig); err != nil {
+			pm.asrPool.Put(asrRes)
+			ttsPool.Put(ttsRes)
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// WithTTS 从默认TTS资源池借出一个实例执行fn，执行完毕后归还，用于会话之外的语音合成
+func (pm *PoolManager) WithTTS(fn func(providers.TTSProvider) error) error {
+	key, err := pm.ttsKey("", "")
+	if err != nil {
+		return err
+	}
+	pool := pm.ttsPools[key]
+	res, err := pool.Get()
+	if err != nil {
+		return err
+	}
+	defer pool.Put(res)
+	return fn(res.(providers.TTSProvider))
+}
+
+// ReturnProviderSet 会话结束后归还服务提供者
+func (pm *PoolManager) ReturnProviderSet(set *ProviderSet) error {
+	if set == nil {
+		return nil
+	}
+
+	var lastErr error
+	if set.ASR != nil {
+		// 复位ASR状态并解除监听器，避免下一个会话收到上一个会话的识别结果
+		set.ASR.SetListener(nil)
+		if err := set.ASR.Reset(); err != nil {
+			pm.logger.Error(fmt.Sprintf("复位ASR失败: %v", err))
+		}
+		if err := pm.asrPool.Put(set.ASR); err != nil {
+			lastErr = err
+		}
+	}
+	if set.TTS != nil && set.ttsPool != nil {
+		if err := set.ttsPool.Put(set.TTS); err != nil {
+			lastErr = err
+		}
+	}
+	if set.VAD != nil {
+		if err := set.VAD.Cleanup(); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Close 关闭所有资源池
+func (pm *PoolManager) Close() error {
+	var lastErr error
+	if pm.asrPool != nil {
+		if err := pm.asrPool.Close(); err != nil {
+			lastErr = err
+		}
+	}
+	for _, pool := range pm.ttsPools {
+		if err := pool.Close(); err != nil {
+			lastErr = err
+		}
+	}
+	for _, llmProvider := range pm.llms {
+		if err := llmProvider.Cleanup(); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// asrFactory ASR资源工厂
+type asrFactory struct {
+	config      configs.ASRConfig
+	deleteAudio bool
+}
+
+func (f *asrFactory) Create() (interface{}, error) {
+	asrType, _ := f.config["type"].(string)
+	provider, err := asr.Create(asrType, &asr.Config{
+		Type: asrType,
+		Data: f.config,
+	}, f.deleteAudio)
+	if err != nil {
+		return nil, err
+	}
+	asrProvider, ok := provider.(providers.ASRProvider)
+	if !ok {
+		return nil, fmt.Errorf("ASR提供者%s未实现ASRProvider接口", asrType)
+	}
+	return asrProvider, nil
+}
+
+func (f *asrFactory) Destroy(resource interface{}) error {
+	if provider, ok := resource.(providers.ASRProvider); ok {
+		return provider.Cleanup()
+	}
+	return nil
+}
+
+// ttsFactory TTS资源工厂
+type ttsFactory struct {
+	config      configs.TTSConfig
+	deleteAudio bool
+}
+
+func (f *ttsFactory) Create() (interface{}, error) {
+	return tts.Create(f.config.Type, &tts.Config{
+		Type:      f.config.Type,
+		Voice:     f.config.Voice,
+		Format:    f.config.Format,
+		OutputDir: f.config.OutputDir,
+		AppID:     f.config.AppID,
+		Token:     f.config.Token,
+		Cluster:   f.config.Cluster,
+	}, f.deleteAudio)
+}
+
+func (f *ttsFactory) Destroy(resource interface{}) error {
+	if provider, ok := resource.(providers.TTSProvider); ok {
+		return provider.Cleanup()
+	}
+	return nil
+}
+
+// newVAD 根据配置创建VAD实例
+func newVAD(config *configs.VADConfig) (providers.VADProvider, error) {
+	return vad.Create(config.Type, &vad.Config{
+		Type:               config.Type,
+		ModelDir:           config.ModelDir,
+		Threshold:          config.Threshold,
+		MinSilenceDuration: config.MinSilenceDuration,
+		Extra:              config.Extra,
+	})
+}
@@ -0,0 +1,126 @@
+package pool
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ResourceFactory 资源工厂接口，负责创建和销毁池中的资源
+type ResourceFactory interface {
+	Create() (interface{}, error)
+	Destroy(resource interface{}) error
+}
+
+// ResourcePool 通用资源池
+// 获取资源时优先复用空闲实例，没有空闲实例则立即新建，不会阻塞调用方；
+// 归还资源时如果空闲实例已达上限，则直接销毁该实例
+type ResourcePool struct {
+	name    string
+	factory ResourceFactory
+	idle    chan interface{}
+	minSize int
+	maxSize int
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewResourcePool 创建资源池并预创建minSize个实例
+func NewResourcePool(name string, factory ResourceFactory, minSize, maxSize int) (*ResourcePool, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("资源池%s的最大空闲数必须大于0", name)
+	}
+	if minSize > maxSize {
+		minSize = maxSize
+	}
+
+	p := &ResourcePool{
+		name:    name,
+		factory: factory,
+		idle:    make(chan interface{}, maxSize),
+		minSize: minSize,
+		maxSize: maxSize,
+	}
+
+	for i := 0; i < minSize; i++ {
+		resource, err := factory.Create()
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("预创建%s资源失败: %v", name, err)
+		}
+		p.idle <- resource
+	}
+
+	return p, nil
+}
+
+// Get 从资源池获取一个资源
+func (p *ResourcePool) Get() (interface{}, error) {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return nil, fmt.Errorf("资源池%s已关闭", p.name)
+	}
+
+	select {
+	case resource := <-p.idle:
+		return resource, nil
+	default:
+		resource, err := p.factory.Create()
+		if err != nil {
+			return nil, fmt.Errorf("创建%s资源失败: %v", p.name, err)
+		}
+		return resource, nil
+	}
+}
+
+// Put 归还资源到资源池
+func (p *ResourcePool) Put(resource interface{}) error {
+	if resource == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return p.factory.Destroy(resource)
+	}
+
+	select {
+	case p.idle <- resource:
+		return nil
+	default:
+		// 空闲实例已满，销毁多余的实例
+		return p.factory.Destroy(resource)
+	}
+}
+
+// IdleCount 返回当前空闲资源数量
+func (p *ResourcePool) IdleCount() int {
+	return len(p.idle)
+}
+
+// Close 关闭资源池并销毁所有空闲资源
+func (p *ResourcePool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	var lastErr error
+	for {
+		select {
+		case resource := <-p.idle:
+			if err := p.factory.Destroy(resource); err != nil {
+				lastErr = err
+			}
+		default:
+			return lastErr
+		}
+	}
+}
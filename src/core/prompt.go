@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"xiaozhi-server-go/src/core/tools"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// ipLocationTimeout 查询客户端IP归属地的超时时间
+const ipLocationTimeout = 3 * time.Second
+
+// promptVars 系统提示词模板可使用的变量，每轮对话开始时重新生成
+// 模板语法为Go text/template，例如 {{.Date}}、{{if .Nickname}}用户叫{{.Nickname}}{{end}}
+type promptVars struct {
+	Name       string                       // 助手名称
+	Language   string                       // 回复使用的语言
+	Date       string                       // 设备时区的当前日期，如2006年01月02日
+	Time       string                       // 设备时区的当前时间，如15:04
+	Weekday    string                       // 星期，如星期一
+	Timezone   string                       // 设备时区，如Asia/Shanghai
+	DeviceID   string                       // 设备ID
+	DeviceName string                       // 设备名称
+	Nickname   string                       // 用户昵称
+	Location   string                       // 设备所在地区
+	Battery    string                       // 电量百分比，设备未上报时为空
+	IoT        map[string]map[string]string // 设备上报的IoT状态，如 {{.IoT.Speaker.volume}}
+}
+
+// parsePromptTemplate 解析系统提示词模板，缺失的变量渲染为空
+func parsePromptTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("prompt").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("解析系统提示词模板失败: %v", err)
+	}
+	return tmpl, nil
+}
+
+// refreshSystemPrompt 使用当前的变量渲染系统提示词，并更新对话中的system消息
+// 渲染失败时保留上一次的提示词
+func (h *ConnectionHandler) refreshSystemPrompt() {
+	if h.promptTmpl == nil {
+		return
+	}
+	var sb strings.Builder
+	if err := h.promptTmpl.Execute(&sb, h.collectPromptVars()); err != nil {
+		h.logger.Error(fmt.Sprintf("渲染系统提示词失败: %v", err))
+		return
+	}
+	h.dialogueManager.SetSystemPrompt(sb.String())
+}
+
+// collectPromptVars 收集系统提示词模板变量
+// 设备信息优先使用devices中的配置，其次使用激活时填写的别名和客户端IP归属地
+func (h *ConnectionHandler) collectPromptVars() promptVars {
+	deviceID := h.headers["device-id"]
+	device := h.config.Devices[deviceID]
+	ipInfo := h.getClientIPInfo()
+
+	vars := promptVars{
+		Name:       h.agent.Name,
+		Language:   h.agent.Language,
+		DeviceID:   deviceID,
+		DeviceName: device.Name,
+		Nickname:   device.Nickname,
+		Location:   device.Location,
+		IoT:        make(map[string]map[string]string),
+	}
+
+	if vars.DeviceName == "" && h.activation != nil {
+		if bound, ok := h.activation.Store().Get(deviceID); ok {
+			vars.DeviceName = bound.Alias
+		}
+	}
+	if vars.Location == "" {
+		vars.Location = ipLocationName(ipInfo)
+	}
+
+	// 时区依次取设备配置、IP归属地，都没有时使用服务器时区
+	loc := time.Local
+	timezone := device.Timezone
+	if timezone == "" {
+		timezone, _ = ipInfo["timezone"].(string)
+	}
+	if timezone != "" {
+		if l, err := time.LoadLocation(timezone); err == nil {
+			loc = l
+		} else {
+			h.logger.Warn(fmt.Sprintf("无效的时区%s: %v", timezone, err))
+		}
+	}
+	now := time.Now().In(loc)
+	vars.Date = now.Format("2006年01月02日")
+	vars.Time = now.Format("15:04")
+	vars.Weekday = tools.WeekdayName(now)
+	vars.Timezone = loc.String()
+
+	for thing, props := range h.iotModel.States() {
+		values := make(map[string]string, len(props))
+		for k, v := range props {
+			values[k] = fmt.Sprint(v)
+		}
+		vars.IoT[thing] = values
+	}
+	vars.Battery = vars.IoT["Battery"]["level"]
+
+	return vars
+}
+
+// lookupClientLocation 后台查询客户端IP归属地，供系统提示词使用
+func (h *ConnectionHandler) lookupClientLocation() {
+	if !h.config.IPLocation.Enabled || !utils.IsPublicIP(h.clientIP) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ipLocationTimeout)
+	defer cancel()
+	info, err := utils.LookupIPLocation(ctx, h.config.IPLocation.URL, h.clientIP)
+	if err != nil {
+		h.logger.Warn(fmt.Sprintf("查询客户端%s的归属地失败: %v", h.clientIP, err))
+		return
+	}
+	h.clientIPInfoMu.Lock()
+	h.clientIPInfo = info
+	h.clientIPInfoMu.Unlock()
+}
+
+// getClientIPInfo 返回客户端IP归属地，尚未查询到时为nil
+func (h *ConnectionHandler) getClientIPInfo() map[string]interface{} {
+	h.clientIPInfoMu.RLock()
+	defer h.clientIPInfoMu.RUnlock()
+	return h.clientIPInfo
+}
+
+// ipLocationName 由IP归属地生成地区名称，省份与城市相同时只保留一个
+func ipLocationName(info map[string]interface{}) string {
+	region, _ := info["regionName"].(string)
+	city, _ := info["city"].(string)
+	switch {
+	case region != "" && city != "" && region != city:
+		return region + city
+	case city != "":
+		return city
+	case region != "":
+		return region
+	}
+	country, _ := info["country"].(string)
+	return country
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderPromptTemplate(t *testing.T) {
+	vars := promptVars{
+		Name:     "小智",
+		Date:     "2024年05月01日",
+		Weekday:  "星期三",
+		Location: "广东省深圳市",
+		IoT:      map[string]map[string]string{"Speaker": {"volume": "30"}},
+	}
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"普通变量", "今天是{{.Date}}{{.Weekday}}", "今天是2024年05月01日星期三"},
+		{"条件变量", "{{if .Nickname}}用户叫{{.Nickname}}{{else}}不知道用户的名字{{end}}", "不知道用户的名字"},
+		{"IoT状态", "当前音量{{.IoT.Speaker.volume}}", "当前音量30"},
+		{"未上报的IoT状态渲染为空", "电量{{.IoT.Battery.level}}", "电量"},
+		{"纯文本", "你是一个助手", "你是一个助手"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parsePromptTemplate(tt.text)
+			if err != nil {
+				t.Fatalf("parsePromptTemplate() error = %v", err)
+			}
+			var sb strings.Builder
+			if err := tmpl.Execute(&sb, vars); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := sb.String(); got != tt.want {
+				t.Errorf("rendered prompt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePromptTemplateInvalid(t *testing.T) {
+	if _, err := parsePromptTemplate("{{if .Nickname}}"); err == nil {
+		t.Error("parsePromptTemplate() with unclosed action should fail")
+	}
+}
+
+func TestIPLocationName(t *testing.T) {
+	tests := []struct {
+		name string
+		info map[string]interface{}
+		want string
+	}{
+		{"省份和城市", map[string]interface{}{"regionName": "广东省", "city": "深圳市"}, "广东省深圳市"},
+		{"省份与城市相同", map[string]interface{}{"regionName": "北京市", "city": "北京市"}, "北京市"},
+		{"只有城市", map[string]interface{}{"city": "深圳市"}, "深圳市"},
+		{"只有省份", map[string]interface{}{"regionName": "广东省"}, "广东省"},
+		{"只有国家", map[string]interface{}{"country": "中国"}, "中国"},
+		{"未查询到", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ipLocationName(tt.info); got != tt.want {
+				t.Errorf("ipLocationName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
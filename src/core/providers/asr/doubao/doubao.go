@@ -13,6 +13,7 @@ import (
 	"sync"
 	"time"
 
+	"xiaozhi-server-go/src/core/providers"
 	"xiaozhi-server-go/src/core/providers/asr"
 	"xiaozhi-server-go/src/core/utils"
 
@@ -74,6 +75,7 @@ type Provider struct {
 	reqID       string
 	result      string
 	err         error
+	finalCount  int        // 已作为最终结果通知的分句数
 	connMutex   sync.Mutex // 添加互斥锁保护连接状态
 }
 
@@ -272,8 +274,8 @@ func (p *Provider) constructRequest() map[string]interface{} {
 			"enable_punc":     p.enablePunc,
 			"enable_itn":      p.enableITN,
 			"enable_ddc":      p.enableDDC,
-			"result_type":     "single",
-			"show_utterances": false, // Added show_utterances, default to false
+			"result_type":     "full", // 全量返回，分句序号在整个识别过程中保持不变
+			"show_utterances": true,   // 返回分句信息，用于区分中间结果和最终结果
 		},
 	}
 }
@@ -298,13 +300,14 @@ func (p *Provider) parseResponse(data []byte) (map[string]interface{}, error) {
 	_ = data[0] >> 4 // protocol version
 	headerSize := data[0] & 0x0f
 	messageType := data[1] >> 4
-	_ = data[1] & 0x0f // flags
+	flags := data[1] & 0x0f
 	serializationMethod := data[2] >> 4
 	compressionMethod := data[2] & 0x0f
 
 	// 跳过头部获取payload
 	payload := data[headerSize*4:]
 	result := make(map[string]interface{})
+	result["is_last"] = flags&negSequence != 0 // 负序号表示最后一包
 
 	var payloadMsg []byte
 	var payloadSize int32
@@ -404,6 +407,7 @@ func (p *Provider) AddAudioWithContext(ctx context.Context, data []byte) error {
 		p.InitAudioProcessing()
 		p.result = ""
 		p.err = nil
+		p.finalCount = 0
 
 		// 确保旧连接已关闭
 		if p.conn != nil {
@@ -501,21 +505,21 @@ func (p *Provider) AddAudioWithContext(ctx context.Context, data []byte) error {
 
 		p.isStreaming = true
 		// 开启一个协程来处理响应，读取最后的结果，读取完成后关闭协程
-		go func() {
+		go func(conn *websocket.Conn) {
 			for {
-				_, response, err := p.conn.ReadMessage()
+				_, response, err := conn.ReadMessage()
 				if err != nil {
-					p.connMutex.Lock()
-					p.err = fmt.Errorf("读取响应失败: %v", err)
-					p.connMutex.Unlock()
+					p.setError(conn, fmt.Errorf("读取响应失败: %v", err))
 					return
 				}
 
 				result, err := p.parseResponse(response)
 				if err != nil {
-					p.connMutex.Lock()
-					p.err = fmt.Errorf("解析响应失败: %v", err)
-					p.connMutex.Unlock()
+					p.setError(conn, fmt.Errorf("解析响应失败: %v", err))
+					return
+				}
+				if code, ok := result["code"].(uint32); ok {
+					p.setError(conn, fmt.Errorf("ASR服务返回错误(%d): %v", code, result["payload_msg"]))
 					return
 				}
 
@@ -523,32 +527,30 @@ func (p *Provider) AddAudioWithContext(ctx context.Context, data []byte) error {
 
 				payloadMsgData, err := json.Marshal(result["payload_msg"])
 				if err != nil {
-					p.connMutex.Lock()
-					p.err = fmt.Errorf("重新序列化响应payload_msg失败: %v", err)
-					p.connMutex.Unlock()
+					p.setError(conn, fmt.Errorf("重新序列化响应payload_msg失败: %v", err))
 					return
 				}
 
 				if err := json.Unmarshal(payloadMsgData, &respPayload); err != nil {
-					p.connMutex.Lock()
-					p.err = fmt.Errorf("解析最终响应payload失败: %v. Raw: %s", err, string(payloadMsgData))
-					p.connMutex.Unlock()
+					p.setError(conn, fmt.Errorf("解析最终响应payload失败: %v. Raw: %s", err, string(payloadMsgData)))
+					return
+				}
+
+				if respPayload.Code != 20000000 && respPayload.Code != 0 {
+					p.setError(conn, fmt.Errorf("ASR识别错误(%d): %s", respPayload.Code, respPayload.Message))
 					return
 				}
 
-				if respPayload.Code == 20000000 || respPayload.Code == 0 {
-					p.connMutex.Lock()
-					p.result = respPayload.Result.Text
-					p.connMutex.Unlock()
+				p.connMutex.Lock()
+				p.result = respPayload.Result.Text
+				p.connMutex.Unlock()
 
-					if listener := p.BaseProvider.GetListener(); listener != nil {
-						if finished := listener.OnAsrResult(respPayload.Result.Text); finished {
-							return
-						}
-					}
+				isLast, _ := result["is_last"].(bool)
+				if p.notifyResults(respPayload.Result, isLast) || isLast {
+					return
 				}
 			}
-		}()
+		}(p.conn)
 	}
 
 	// 直接处理传入的音频数据，不使用缓冲区
@@ -575,6 +577,76 @@ func (p *Provider) AddAudioWithContext(ctx context.Context, data []byte) error {
 	return nil
 }
 
+// notifyResults 按分句通知识别结果，已确定的分句只通知一次，未确定的分句作为中间结果
+// 返回true表示监听器要求停止识别
+func (p *Provider) notifyResults(result ResultPayload, isLast bool) bool {
+	listener := p.BaseProvider.GetListener()
+	if listener == nil {
+		return false
+	}
+
+	utterances := result.Utterances
+	if len(utterances) == 0 {
+		// 没有分句信息时整段文本作为一句
+		utterances = []Utterance{{Text: result.Text, Definite: isLast}}
+	}
+
+	p.connMutex.Lock()
+	start := p.finalCount
+	p.connMutex.Unlock()
+	if start > len(utterances) {
+		start = len(utterances)
+	}
+
+	var results []providers.AsrResult
+	for _, u := range utterances[start:] {
+		final := u.Definite || isLast
+		results = append(results, providers.AsrResult{
+			Text:      u.Text,
+			IsFinal:   final,
+			StartTime: u.StartTime,
+			EndTime:   u.EndTime,
+		})
+		if !final {
+			// 未确定的分句之后不会再有已确定的分句
+			break
+		}
+		p.connMutex.Lock()
+		p.finalCount++
+		p.connMutex.Unlock()
+	}
+	if isLast {
+		if len(results) == 0 {
+			results = append(results, providers.AsrResult{IsFinal: true})
+		}
+		results[len(results)-1].IsLast = true
+	}
+
+	for _, r := range results {
+		if listener.OnAsrResult(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// setError 记录识别错误并通知监听器，连接已被Reset或Cleanup主动关闭时不通知
+func (p *Provider) setError(conn *websocket.Conn, err error) {
+	p.connMutex.Lock()
+	closed := p.conn != conn
+	if !closed {
+		p.err = err
+	}
+	p.connMutex.Unlock()
+	if closed {
+		return
+	}
+
+	if listener := p.BaseProvider.GetListener(); listener != nil {
+		listener.OnAsrError(err)
+	}
+}
+
 func (p *Provider) closeConnection() {
 	if p.conn != nil {
 		_ = p.conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
@@ -637,6 +709,7 @@ func (p *Provider) Reset() error {
 	p.reqID = ""
 	p.result = ""
 	p.err = nil
+	p.finalCount = 0
 
 	// 重置音频处理
 	p.InitAudioProcessing()
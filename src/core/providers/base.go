@@ -2,6 +2,7 @@ package providers
 
 import (
 	"context"
+	"io"
 	"xiaozhi-server-go/src/core/types"
 )
 
@@ -11,8 +12,22 @@ type Provider interface {
 	Cleanup() error
 }
 
+// AsrResult 语音识别结果
+// 中间结果在后续可能被修正，同一句话确定后以IsFinal再通知一次
+type AsrResult struct {
+	Text      string
+	IsFinal   bool // 本句识别结果已确定
+	IsLast    bool // 本次识别的最后一个结果，Finalize后或识别结束时为true
+	StartTime int  // 本句在音频中的开始时间(毫秒)，未知时为0
+	EndTime   int  // 本句在音频中的结束时间(毫秒)，未知时为0
+}
+
+// AsrEventListener 语音识别事件监听器
 type AsrEventListener interface {
-	OnAsrResult(result string) bool
+	// 收到识别结果，返回true则停止语音识别，返回false继续识别
+	OnAsrResult(result AsrResult) bool
+	// 识别出错，本次识别已中断，需Reset后重新开始
+	OnAsrError(err error)
 }
 
 // ASRProvider 语音识别提供者接口
@@ -31,6 +46,7 @@ type ASRProvider interface {
 }
 
 // TTSProvider 语音合成提供者接口
+// 同一会话会并发合成多句文本，ToTTS和ToTTSStream需支持并发调用，每次调用互不影响
 type TTSProvider interface {
 	Provider
 
@@ -38,6 +54,43 @@ type TTSProvider interface {
 	ToTTS(text string) (string, error)
 }
 
+// AudioStream 流式合成的音频，数据为16位小端单声道PCM，读取完毕返回io.EOF
+// 未读取完毕时调用Close可中止合成
+type AudioStream struct {
+	io.ReadCloser
+	SampleRate int
+}
+
+// TTSStreamProvider 支持流式合成的语音合成提供者
+// 合成过程中即可读取音频，首帧无需等待整句合成完成，也不产生临时文件
+type TTSStreamProvider interface {
+	TTSProvider
+
+	// 合成音频并返回音频流，ctx取消后中止合成，音频流随之结束
+	ToTTSStream(ctx context.Context, text string) (*AudioStream, error)
+}
+
+// VADEvent 语音活动检测事件
+type VADEvent int
+
+const (
+	VADEventNone        VADEvent = iota // 状态未变化
+	VADEventSpeechStart                 // 检测到开始说话
+	VADEventSpeechEnd                   // 检测到说话结束
+)
+
+// VADProvider 语音活动检测提供者接口
+type VADProvider interface {
+	Provider
+
+	// 处理一帧16位单声道PCM数据，返回检测到的事件
+	ProcessAudio(pcm []byte) VADEvent
+	// 当前是否处于说话状态
+	IsSpeaking() bool
+	// 复位检测状态
+	Reset()
+}
+
 // LLMProvider 大语言模型提供者接口
 type LLMProvider interface {
 	types.LLMProvider
@@ -5,6 +5,8 @@ import (
 	"fmt"
 
 	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
 )
 
 // Config LLM配置结构
@@ -137,3 +139,26 @@ func ValidateFunctionArguments(params types.FunctionParams, args map[string]inte
 
 	return nil
 }
+
+// ToOpenAIMessages 转换为openai消息格式，保留工具调用信息，供兼容OpenAI接口的提供者使用
+func ToOpenAIMessages(messages []types.Message) []openai.ChatCompletionMessage {
+	chatMessages := make([]openai.ChatCompletionMessage, len(messages))
+	for i, msg := range messages {
+		chatMessages[i] = openai.ChatCompletionMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCallID: msg.ToolCallID,
+		}
+		for _, tc := range msg.ToolCalls {
+			chatMessages[i].ToolCalls = append(chatMessages[i].ToolCalls, openai.ToolCall{
+				ID:   tc.ID,
+				Type: openai.ToolType(tc.Type),
+				Function: openai.FunctionCall{
+					Name:      tc.Function.Name,
+					Arguments: tc.Function.Arguments,
+				},
+			})
+		}
+	}
+	return chatMessages
+}
@@ -0,0 +1,34 @@
+package llm
+
+import (
+	"reflect"
+	"testing"
+
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestToOpenAIMessages(t *testing.T) {
+	call := types.ToolCall{ID: "call_1", Type: "function"}
+	call.Function.Name = "get_current_time"
+	call.Function.Arguments = "{}"
+
+	got := ToOpenAIMessages([]types.Message{
+		{Role: "user", Content: "现在几点"},
+		{Role: "assistant", ToolCalls: []types.ToolCall{call}},
+		{Role: "tool", Content: "15:04", ToolCallID: "call_1"},
+	})
+	want := []openai.ChatCompletionMessage{
+		{Role: "user", Content: "现在几点"},
+		{Role: "assistant", ToolCalls: []openai.ToolCall{{
+			ID:       "call_1",
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "get_current_time", Arguments: "{}"},
+		}}},
+		{Role: "tool", Content: "15:04", ToolCallID: "call_1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ToOpenAIMessages() = %+v, want %+v", got, want)
+	}
+}
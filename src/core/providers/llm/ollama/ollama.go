@@ -82,13 +82,7 @@ func (p *Provider) Response(ctx context.Context, sessionID string, messages []ty
 		}
 
 		// 转换消息格式
-		chatMessages := make([]openai.ChatCompletionMessage, len(messages))
-		for i, msg := range messages {
-			chatMessages[i] = openai.ChatCompletionMessage{
-				Role:    msg.Role,
-				Content: msg.Content,
-			}
-		}
+		chatMessages := llm.ToOpenAIMessages(messages)
 
 		stream, err := p.client.CreateChatCompletionStream(
 			ctx,
@@ -148,13 +142,7 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 		}
 
 		// 转换消息格式
-		chatMessages := make([]openai.ChatCompletionMessage, len(messages))
-		for i, msg := range messages {
-			chatMessages[i] = openai.ChatCompletionMessage{
-				Role:    msg.Role,
-				Content: msg.Content,
-			}
-		}
+		chatMessages := llm.ToOpenAIMessages(messages)
 
 		// 转换函数定义
 		tools := make([]openai.Tool, len(functions))
@@ -169,6 +157,9 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 					if len(schema.Enum) > 0 {
 						propMap["enum"] = schema.Enum
 					}
+					if schema.Items != nil {
+						propMap["items"] = schema.Items
+					}
 					params[name] = propMap
 				}
 			}
@@ -221,9 +212,14 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 				if delta.ToolCalls != nil && len(delta.ToolCalls) > 0 {
 					toolCalls := make([]types.ToolCall, len(delta.ToolCalls))
 					for i, tc := range delta.ToolCalls {
+						index := i
+						if tc.Index != nil {
+							index = *tc.Index
+						}
 						toolCalls[i] = types.ToolCall{
-							ID:   tc.ID,
-							Type: string(tc.Type),
+							Index: index,
+							ID:    tc.ID,
+							Type:  string(tc.Type),
 							Function: types.FunctionCall{
 								Name:      tc.Function.Name,
 								Arguments: tc.Function.Arguments,
@@ -307,4 +303,4 @@ func (p *Provider) handleThinkTagsWithBuffer(buffer string, isActive bool) (stri
 	}
 
 	return buffer, isActive
-} 
\ No newline at end of file
+}
@@ -3,6 +3,7 @@ package doubao
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"xiaozhi-server-go/src/core/providers"
 	"xiaozhi-server-go/src/core/providers/tts"
 
 	"github.com/google/uuid"
@@ -43,6 +45,13 @@ var (
 // reserved data: 0x00 (1 byte)
 var defaultHeader = []byte{0x11, 0x10, 0x11, 0x00}
 
+const (
+	// streamSampleRate 合成音频的采样率
+	streamSampleRate = 24000
+	// streamTimeout 流式合成时等待服务端数据的超时时间
+	streamTimeout = 10 * time.Second
+)
+
 type synResp struct {
 	Audio  []byte
 	IsLast bool
@@ -67,13 +76,98 @@ func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
 
 // ToTTS 实现文本到语音的转换
 func (p *Provider) ToTTS(text string) (string, error) {
+	conn, err := p.submit(context.Background(), text, "mp3")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	// 创建临时文件
+	outputDir := p.Config().OutputDir
+	if outputDir == "" {
+		outputDir = "tmp"
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("创建输出目录失败: %v", err)
+	}
+
+	tempFile := filepath.Join(outputDir, fmt.Sprintf("doubao_tts_%d.mp3", time.Now().UnixNano()))
+	var audioData []byte
+
+	// 接收音频数据
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return "", fmt.Errorf("接收响应失败: %v", err)
+		}
+
+		resp, err := p.parseResponse(message)
+		if err != nil {
+			return "", fmt.Errorf("解析响应失败: %v", err)
+		}
+
+		audioData = append(audioData, resp.Audio...)
+		if resp.IsLast {
+			break
+		}
+	}
+
+	// 写入音频文件
+	if err := os.WriteFile(tempFile, audioData, 0644); err != nil {
+		return "", fmt.Errorf("写入音频文件失败: %v", err)
+	}
+
+	return tempFile, nil
+}
+
+// ToTTSStream 流式合成，服务端返回的PCM数据直接作为音频流，不写入临时文件
+// ctx取消时关闭连接，正在进行的合成随之中止
+func (p *Provider) ToTTSStream(ctx context.Context, text string) (*providers.AudioStream, error) {
+	conn, err := p.submit(ctx, text, "pcm")
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	r, w := io.Pipe()
+	go func() {
+		defer stop()
+		defer conn.Close()
+		for {
+			conn.SetReadDeadline(time.Now().Add(streamTimeout))
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				w.CloseWithError(fmt.Errorf("接收响应失败: %v", err))
+				return
+			}
+
+			resp, err := p.parseResponse(message)
+			if err != nil {
+				w.CloseWithError(fmt.Errorf("解析响应失败: %v", err))
+				return
+			}
+			if _, err := w.Write(resp.Audio); err != nil {
+				// 读取方已关闭，中止合成
+				return
+			}
+			if resp.IsLast {
+				w.Close()
+				return
+			}
+		}
+	}()
+
+	return &providers.AudioStream{ReadCloser: r, SampleRate: streamSampleRate}, nil
+}
+
+// submit 建立连接并提交合成请求，encoding为返回的音频编码
+func (p *Provider) submit(ctx context.Context, text string, encoding string) (*websocket.Conn, error) {
 	// 创建WebSocket连接
 	header := http.Header{"Authorization": []string{fmt.Sprintf("Bearer;%s", p.Config().Token)}}
-	conn, _, err := websocket.DefaultDialer.Dial(p.baseURL, header)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, p.baseURL, header)
 	if err != nil {
-		return "", fmt.Errorf("连接WebSocket服务器失败: %v", err)
+		return nil, fmt.Errorf("连接WebSocket服务器失败: %v", err)
 	}
-	defer conn.Close()
 
 	// 准备请求参数
 	reqParams := map[string]map[string]interface{}{
@@ -87,7 +181,8 @@ func (p *Provider) ToTTS(text string) (string, error) {
 		},
 		"audio": {
 			"voice_type":   p.Config().Voice,
-			"encoding":     "mp3",
+			"encoding":     encoding,
+			"rate":         streamSampleRate,
 			"speed_ratio":  1.0,
 			"volume_ratio": 1.0,
 			"pitch_ratio":  1.0,
@@ -103,13 +198,15 @@ func (p *Provider) ToTTS(text string) (string, error) {
 	// 序列化并压缩请求参数
 	jsonData, err := json.Marshal(reqParams)
 	if err != nil {
-		return "", fmt.Errorf("序列化请求参数失败: %v", err)
+		conn.Close()
+		return nil, fmt.Errorf("序列化请求参数失败: %v", err)
 	}
 
 	var b bytes.Buffer
 	w := gzip.NewWriter(&b)
 	if _, err := w.Write(jsonData); err != nil {
-		return "", fmt.Errorf("压缩请求数据失败: %v", err)
+		conn.Close()
+		return nil, fmt.Errorf("压缩请求数据失败: %v", err)
 	}
 	w.Close()
 	compressed := b.Bytes()
@@ -124,45 +221,10 @@ func (p *Provider) ToTTS(text string) (string, error) {
 
 	// 发送请求
 	if err := conn.WriteMessage(websocket.BinaryMessage, request); err != nil {
-		return "", fmt.Errorf("发送请求失败: %v", err)
-	}
-
-	// 创建临时文件
-	outputDir := p.Config().OutputDir
-	if outputDir == "" {
-		outputDir = "tmp"
-	}
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return "", fmt.Errorf("创建输出目录失败: %v", err)
+		conn.Close()
+		return nil, fmt.Errorf("发送请求失败: %v", err)
 	}
-
-	tempFile := filepath.Join(outputDir, fmt.Sprintf("doubao_tts_%d.mp3", time.Now().UnixNano()))
-	var audioData []byte
-
-	// 接收音频数据
-	for {
-		_, message, err := conn.ReadMessage()
-		if err != nil {
-			return "", fmt.Errorf("接收响应失败: %v", err)
-		}
-
-		resp, err := p.parseResponse(message)
-		if err != nil {
-			return "", fmt.Errorf("解析响应失败: %v", err)
-		}
-
-		audioData = append(audioData, resp.Audio...)
-		if resp.IsLast {
-			break
-		}
-	}
-
-	// 写入音频文件
-	if err := os.WriteFile(tempFile, audioData, 0644); err != nil {
-		return "", fmt.Errorf("写入音频文件失败: %v", err)
-	}
-
-	return tempFile, nil
+	return conn, nil
 }
 
 // parseResponse 解析服务器响应
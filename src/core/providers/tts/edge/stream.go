@@ -0,0 +1,140 @@
+package edge
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/wujunwei928/edge-tts-go/edge_tts"
+)
+
+const (
+	// streamSampleRate 流式合成输出格式 audio-24khz-48kbitrate-mono-mp3 的采样率
+	streamSampleRate = 24000
+	// streamTimeout 建立连接和等待音频数据的超时时间
+	streamTimeout = 10 * time.Second
+)
+
+// ToTTSStream 流式合成，边接收MP3数据边解码为PCM，不写入临时文件
+// edge-tts-go 只提供整句返回的接口，这里直接实现Edge的WebSocket协议
+// ctx取消时关闭连接，正在进行的合成随之中止
+func (p *Provider) ToTTSStream(ctx context.Context, text string) (*providers.AudioStream, error) {
+	voice := p.BaseProvider.Config().Voice
+	if voice == "" {
+		voice = "zh-CN-XiaoxiaoNeural" // 默认声音
+	}
+
+	conn, err := dialEdge(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("连接Edge TTS服务失败: %v", err)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	timestamp := time.Now().UTC().Format("Mon Jan 02 2006 15:04:05 GMT+0000 (Coordinated Universal Time)")
+	speechConfig := "X-Timestamp:" + timestamp + "\r\n" +
+		"Content-Type:application/json; charset=utf-8\r\n" +
+		"Path:speech.config\r\n\r\n" +
+		`{"context":{"synthesis":{"audio":{"metadataoptions":{` +
+		`"sentenceBoundaryEnabled":"false","wordBoundaryEnabled":"false"},` +
+		`"outputFormat":"audio-24khz-48kbitrate-mono-mp3"}}}}` + "\r\n"
+	ssml := fmt.Sprintf("X-RequestId:%s\r\n"+
+		"Content-Type:application/ssml+xml\r\n"+
+		"X-Timestamp:%sZ\r\n"+
+		"Path:ssml\r\n\r\n"+
+		"<speak version='1.0' xmlns='http://www.w3.org/2001/10/synthesis' xml:lang='en-US'>"+
+		"<voice name='%s'><prosody pitch='+0Hz' rate='+0%%' volume='+0%%'>%s</prosody></voice></speak>",
+		connectID(), timestamp, voice, html.EscapeString(text))
+
+	for _, msg := range []string{speechConfig, ssml} {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			stop()
+			conn.Close()
+			return nil, fmt.Errorf("发送Edge TTS请求失败: %v", err)
+		}
+	}
+
+	mp3Reader, mp3Writer := io.Pipe()
+	go func() {
+		defer stop()
+		receiveAudio(conn, mp3Writer)
+	}()
+
+	return &providers.AudioStream{
+		ReadCloser: utils.NewMP3PCMReader(mp3Reader),
+		SampleRate: streamSampleRate,
+	}, nil
+}
+
+// receiveAudio 接收音频数据写入管道，读取方关闭管道后结束
+func receiveAudio(conn *websocket.Conn, w *io.PipeWriter) {
+	defer conn.Close()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(streamTimeout))
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			w.CloseWithError(fmt.Errorf("接收Edge TTS数据失败: %v", err))
+			return
+		}
+
+		switch messageType {
+		case websocket.TextMessage:
+			if bytes.Contains(data, []byte("Path:turn.end")) {
+				w.Close()
+				return
+			}
+		case websocket.BinaryMessage:
+			// 前两字节为头部长度，头部之后为音频数据
+			if len(data) < 2 {
+				w.CloseWithError(fmt.Errorf("Edge TTS音频消息缺少头部"))
+				return
+			}
+			headerLength := int(binary.BigEndian.Uint16(data[:2]))
+			if len(data) < headerLength+2 {
+				w.CloseWithError(fmt.Errorf("Edge TTS音频消息长度不足"))
+				return
+			}
+			if _, err := w.Write(data[2+headerLength:]); err != nil {
+				// 读取方已关闭，中止合成
+				return
+			}
+		}
+	}
+}
+
+// dialEdge 建立与Edge TTS服务的WebSocket连接
+func dialEdge(ctx context.Context) (*websocket.Conn, error) {
+	dialer := &websocket.Dialer{
+		Proxy:             http.ProxyFromEnvironment,
+		HandshakeTimeout:  streamTimeout,
+		EnableCompression: true,
+	}
+	header := http.Header{}
+	for k, v := range edge_tts.WSS_HEADERS {
+		header.Set(k, v)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+	defer cancel()
+
+	url := fmt.Sprintf("%s&Sec-MS-GEC=%s&Sec-MS-GEC-Version=%s&ConnectionId=%s",
+		edge_tts.WSS_URL, edge_tts.GenerateSecMSGec(), edge_tts.SEC_MS_GEC_VERSION, connectID())
+	conn, _, err := dialer.DialContext(ctx, url, header)
+	return conn, err
+}
+
+// connectID 生成不带横线的UUID
+func connectID() string {
+	return strings.ReplaceAll(uuid.New().String(), "-", "")
+}
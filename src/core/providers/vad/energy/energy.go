@@ -0,0 +1,178 @@
+package energy
+
+import (
+	"math"
+	"sync"
+
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/vad"
+)
+
+const (
+	defaultEnergyThreshold = 0.01 // 最低RMS能量，低于该值一律视为静音
+	defaultNoiseRatio      = 3.0  // 语音能量需高于背景噪声的倍数
+	defaultZCRThreshold    = 0.35 // 过零率上限，高于该值多为嘶嘶声等噪声
+	defaultWindowMs        = 300  // 判定开始说话的滑动窗口
+	noiseFloorAlpha        = 0.05 // 背景噪声平滑系数
+)
+
+// frame 滑动窗口中的一帧检测结果
+type frame struct {
+	voiced     bool
+	durationMs int
+}
+
+// Provider 基于短时能量和过零率的VAD，纯Go实现
+// 窗口内有声帧占比达到threshold时判定开始说话，连续静音超过min_silence_duration_ms判定说话结束
+type Provider struct {
+	*vad.BaseProvider
+
+	energyThreshold float64
+	noiseRatio      float64
+	zcrThreshold    float64
+	windowMs        int
+
+	noiseFloor float64
+	window     []frame
+	speaking   bool
+	silenceMs  int
+	mu         sync.Mutex
+}
+
+// NewProvider 创建能量VAD
+func NewProvider(config *vad.Config) (*Provider, error) {
+	base := vad.NewBaseProvider(config)
+	return &Provider{
+		BaseProvider:    base,
+		energyThreshold: getFloat(config.Extra, "energy_threshold", defaultEnergyThreshold),
+		noiseRatio:      getFloat(config.Extra, "noise_ratio", defaultNoiseRatio),
+		zcrThreshold:    getFloat(config.Extra, "zcr_threshold", defaultZCRThreshold),
+		windowMs:        int(getFloat(config.Extra, "window_ms", defaultWindowMs)),
+	}, nil
+}
+
+// ProcessAudio 处理一帧16位单声道PCM数据
+func (p *Provider) ProcessAudio(pcm []byte) providers.VADEvent {
+	samples := len(pcm) / 2
+	if samples == 0 {
+		return providers.VADEventNone
+	}
+
+	rms, zcr := analyze(pcm)
+	durationMs := samples * 1000 / p.Config().SampleRate
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	threshold := math.Max(p.energyThreshold, p.noiseFloor*p.noiseRatio)
+	voiced := rms >= threshold && zcr <= p.zcrThreshold
+
+	// 未说话时持续跟踪背景噪声
+	if !voiced && !p.speaking {
+		if p.noiseFloor == 0 {
+			p.noiseFloor = rms
+		} else {
+			p.noiseFloor += noiseFloorAlpha * (rms - p.noiseFloor)
+		}
+	}
+
+	p.pushFrame(frame{voiced: voiced, durationMs: durationMs})
+
+	if !p.speaking {
+		if float64(p.voicedMs()) >= p.Config().Threshold*float64(p.windowMs) {
+			p.speaking = true
+			p.silenceMs = 0
+			return providers.VADEventSpeechStart
+		}
+		return providers.VADEventNone
+	}
+
+	if voiced {
+		p.silenceMs = 0
+		return providers.VADEventNone
+	}
+	p.silenceMs += durationMs
+	if p.silenceMs >= p.Config().MinSilenceDuration {
+		p.speaking = false
+		p.silenceMs = 0
+		p.window = p.window[:0]
+		return providers.VADEventSpeechEnd
+	}
+	return providers.VADEventNone
+}
+
+// IsSpeaking 当前是否处于说话状态
+func (p *Provider) IsSpeaking() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.speaking
+}
+
+// Reset 复位检测状态，保留已学习的背景噪声
+func (p *Provider) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.speaking = false
+	p.silenceMs = 0
+	p.window = p.window[:0]
+}
+
+// pushFrame 加入一帧并丢弃超出窗口的旧帧，调用方需持有锁
+func (p *Provider) pushFrame(f frame) {
+	p.window = append(p.window, f)
+	total := 0
+	for _, w := range p.window {
+		total += w.durationMs
+	}
+	for len(p.window) > 1 && total-p.window[0].durationMs >= p.windowMs {
+		total -= p.window[0].durationMs
+		p.window = p.window[1:]
+	}
+}
+
+// voicedMs 窗口内有声帧总时长，调用方需持有锁
+func (p *Provider) voicedMs() int {
+	ms := 0
+	for _, w := range p.window {
+		if w.voiced {
+			ms += w.durationMs
+		}
+	}
+	return ms
+}
+
+// analyze 计算归一化RMS能量和过零率
+func analyze(pcm []byte) (float64, float64) {
+	samples := len(pcm) / 2
+	var sum float64
+	crossings := 0
+	var prev int16
+	for i := 0; i < samples; i++ {
+		sample := int16(pcm[2*i]) | int16(pcm[2*i+1])<<8
+		amplitude := float64(sample) / 32768.0
+		sum += amplitude * amplitude
+		if i > 0 && (sample >= 0) != (prev >= 0) {
+			crossings++
+		}
+		prev = sample
+	}
+	return math.Sqrt(sum / float64(samples)), float64(crossings) / float64(samples)
+}
+
+// getFloat 从扩展配置中读取数值参数
+func getFloat(extra map[string]interface{}, key string, defaultValue float64) float64 {
+	switch v := extra[key].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	default:
+		return defaultValue
+	}
+}
+
+func init() {
+	vad.Register("energy", func(config *vad.Config) (vad.Provider, error) {
+		return NewProvider(config)
+	})
+}
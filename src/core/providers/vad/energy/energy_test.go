@@ -0,0 +1,213 @@
+package energy
+
+import (
+	"math"
+	"testing"
+
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/vad"
+)
+
+const (
+	testSampleRate   = 16000
+	testFrameSamples = 320 // 20ms
+)
+
+// segment 一段连续的合成音频
+type segment struct {
+	frames int
+	pcm    func(n int) []byte // 第n帧(全局帧序号)的PCM
+}
+
+// tone 指定频率和幅度(0~1)的正弦波
+func tone(freq, amplitude float64) func(n int) []byte {
+	return func(n int) []byte {
+		pcm := make([]byte, testFrameSamples*2)
+		for i := 0; i < testFrameSamples; i++ {
+			t := float64(n*testFrameSamples+i) / testSampleRate
+			sample := int16(amplitude * 32767 * math.Sin(2*math.Pi*freq*t))
+			pcm[2*i] = byte(sample)
+			pcm[2*i+1] = byte(sample >> 8)
+		}
+		return pcm
+	}
+}
+
+// silence 全零静音
+func silence(int) []byte {
+	return make([]byte, testFrameSamples*2)
+}
+
+// hiss 正负交替的高过零率噪声
+func hiss(int) []byte {
+	pcm := make([]byte, testFrameSamples*2)
+	for i := 0; i < testFrameSamples; i++ {
+		sample := int16(8000)
+		if i%2 == 1 {
+			sample = -8000
+		}
+		pcm[2*i] = byte(sample)
+		pcm[2*i+1] = byte(sample >> 8)
+	}
+	return pcm
+}
+
+// vadEvent 事件及触发时的帧序号
+type vadEvent struct {
+	event providers.VADEvent
+	frame int
+}
+
+func newTestProvider(t *testing.T, threshold float64, minSilence int) *Provider {
+	t.Helper()
+	p, err := NewProvider(&vad.Config{
+		Threshold:          threshold,
+		MinSilenceDuration: minSilence,
+		SampleRate:         testSampleRate,
+	})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	return p
+}
+
+// feed 依次送入各段音频，返回所有非空事件
+func feed(p *Provider, segments []segment) []vadEvent {
+	var events []vadEvent
+	n := 0
+	for _, s := range segments {
+		for i := 0; i < s.frames; i++ {
+			if event := p.ProcessAudio(s.pcm(n)); event != providers.VADEventNone {
+				events = append(events, vadEvent{event, n})
+			}
+			n++
+		}
+	}
+	return events
+}
+
+func TestProcessAudio(t *testing.T) {
+	speech := tone(440, 0.3)
+	start := providers.VADEventSpeechStart
+	end := providers.VADEventSpeechEnd
+
+	tests := []struct {
+		name       string
+		threshold  float64
+		minSilence int
+		segments   []segment
+		want       []vadEvent
+	}{
+		{
+			name:     "静音",
+			segments: []segment{{50, silence}},
+		},
+		{
+			name:     "能量低于阈值",
+			segments: []segment{{50, tone(440, 0.005)}},
+		},
+		{
+			name:     "高过零率噪声",
+			segments: []segment{{50, hiss}},
+		},
+		{
+			// 默认阈值0.5，300ms窗口内有声150ms即第8帧判定开始
+			name:     "持续纯音",
+			segments: []segment{{30, speech}},
+			want:     []vadEvent{{start, 7}},
+		},
+		{
+			name:     "短促纯音不触发",
+			segments: []segment{{7, speech}, {50, silence}},
+		},
+		{
+			name:      "提高阈值延迟开始",
+			threshold: 0.9,
+			segments:  []segment{{30, speech}},
+			want:      []vadEvent{{start, 13}},
+		},
+		{
+			// 默认静音700ms即第35个静音帧判定结束
+			name:     "纯音后静音",
+			segments: []segment{{20, speech}, {50, silence}},
+			want:     []vadEvent{{start, 7}, {end, 54}},
+		},
+		{
+			name:       "自定义静音时长",
+			minSilence: 200,
+			segments:   []segment{{20, speech}, {50, silence}},
+			want:       []vadEvent{{start, 7}, {end, 29}},
+		},
+		{
+			name:     "短暂停顿不结束",
+			segments: []segment{{20, speech}, {20, silence}, {20, speech}, {50, silence}},
+			want:     []vadEvent{{start, 7}, {end, 94}},
+		},
+		{
+			name:     "结束后再次说话",
+			segments: []segment{{20, speech}, {40, silence}, {20, speech}},
+			want:     []vadEvent{{start, 7}, {end, 54}, {start, 67}},
+		},
+		{
+			// 背景噪声抬高阈值后，略高于energy_threshold的声音不再判定为说话
+			name:     "低于背景噪声倍数",
+			segments: []segment{{50, tone(200, 0.007)}, {30, tone(440, 0.017)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t, tt.threshold, tt.minSilence)
+			got := feed(p, tt.segments)
+			if len(got) != len(tt.want) {
+				t.Fatalf("events = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("events = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestIsSpeakingAndReset(t *testing.T) {
+	p := newTestProvider(t, 0, 0)
+	feed(p, []segment{{10, tone(440, 0.3)}})
+	if !p.IsSpeaking() {
+		t.Fatal("IsSpeaking() after tone = false")
+	}
+
+	p.Reset()
+	if p.IsSpeaking() {
+		t.Error("IsSpeaking() after Reset = true")
+	}
+	// 复位后窗口清空，需要重新积累有声帧
+	if got := feed(p, []segment{{7, tone(440, 0.3)}}); len(got) != 0 {
+		t.Errorf("events after Reset = %v, want none", got)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name    string
+		pcm     []byte
+		wantRMS float64
+		wantZCR float64
+	}{
+		{"静音", silence(0), 0, 0},
+		{"纯音", tone(400, 0.5)(0), 0.5 / math.Sqrt2, 2 * 400.0 / testSampleRate},
+		{"正负交替", hiss(0), 8000.0 / 32768, float64(testFrameSamples-1) / testFrameSamples},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rms, zcr := analyze(tt.pcm)
+			if math.Abs(rms-tt.wantRMS) > 0.005 {
+				t.Errorf("rms = %v, want %v", rms, tt.wantRMS)
+			}
+			if math.Abs(zcr-tt.wantZCR) > 0.01 {
+				t.Errorf("zcr = %v, want %v", zcr, tt.wantZCR)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package vad
+
+import (
+	"fmt"
+
+	"xiaozhi-server-go/src/core/providers"
+)
+
+const (
+	defaultThreshold          = 0.5
+	defaultMinSilenceDuration = 700 // 毫秒
+	defaultSampleRate         = 16000
+)
+
+// Config VAD配置结构
+type Config struct {
+	Type               string
+	ModelDir           string
+	Threshold          float64 // 语音判定阈值，取值0~1，越大越不灵敏
+	MinSilenceDuration int     // 静音持续多久判定为说话结束(ms)
+	SampleRate         int     // 输入PCM采样率
+	Extra              map[string]interface{}
+}
+
+// Provider VAD提供者接口
+type Provider interface {
+	providers.VADProvider
+}
+
+// BaseProvider VAD基础实现
+type BaseProvider struct {
+	config *Config
+}
+
+// NewBaseProvider 创建VAD基础提供者，未配置的参数使用默认值
+func NewBaseProvider(config *Config) *BaseProvider {
+	if config.Threshold <= 0 {
+		config.Threshold = defaultThreshold
+	}
+	if config.MinSilenceDuration <= 0 {
+		config.MinSilenceDuration = defaultMinSilenceDuration
+	}
+	if config.SampleRate <= 0 {
+		config.SampleRate = defaultSampleRate
+	}
+	return &BaseProvider{config: config}
+}
+
+// Config 获取配置
+func (p *BaseProvider) Config() *Config {
+	return p.config
+}
+
+// Initialize 初始化提供者
+func (p *BaseProvider) Initialize() error {
+	return nil
+}
+
+// Cleanup 清理资源
+func (p *BaseProvider) Cleanup() error {
+	return nil
+}
+
+// Factory VAD工厂函数类型
+type Factory func(config *Config) (Provider, error)
+
+var (
+	factories = make(map[string]Factory)
+)
+
+// Register 注册VAD提供者工厂
+func Register(name string, factory Factory) {
+	factories[name] = factory
+}
+
+// Create 创建VAD提供者实例
+func Create(name string, config *Config) (Provider, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的VAD提供者: %s", name)
+	}
+
+	provider, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("创建VAD提供者失败: %v", err)
+	}
+
+	if err := provider.Initialize(); err != nil {
+		return nil, fmt.Errorf("初始化VAD提供者失败: %v", err)
+	}
+
+	return provider, nil
+}
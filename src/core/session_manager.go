@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/task"
+
+	"github.com/google/uuid"
+)
+
+// Session 会话信息
+type Session struct {
+	ID        string
+	DeviceID  string
+	ClientID  string
+	ClientIP  string
+	CreatedAt time.Time
+
+	conn    Conn
+	handler *ConnectionHandler
+}
+
+// SessionManager 会话管理器，负责分配会话ID、登记活动会话并在断开时清理资源
+type SessionManager struct {
+	logger   *utils.Logger
+	taskMgr  *task.TaskManager
+	sessions map[string]*Session
+	mu       sync.RWMutex
+}
+
+// NewSessionManager 创建会话管理器
+func NewSessionManager(logger *utils.Logger, taskMgr *task.TaskManager) *SessionManager {
+	return &SessionManager{
+		logger:   logger,
+		taskMgr:  taskMgr,
+		sessions: make(map[string]*Session),
+	}
+}
+
+// CreateSession 创建并登记新会话
+func (sm *SessionManager) CreateSession(deviceID, clientID, clientIP string, conn Conn, handler *ConnectionHandler) *Session {
+	session := &Session{
+		ID:        uuid.New().String(),
+		DeviceID:  deviceID,
+		ClientID:  clientID,
+		ClientIP:  clientIP,
+		CreatedAt: time.Now(),
+		conn:      conn,
+		handler:   handler,
+	}
+
+	sm.mu.Lock()
+	sm.sessions[session.ID] = session
+	count := len(sm.sessions)
+	sm.mu.Unlock()
+
+	sm.logger.Info(fmt.Sprintf("会话已创建: %s, 设备: %s, 客户端: %s, IP: %s, 当前会话数: %d",
+		session.ID, deviceID, clientID, clientIP, count))
+	return session
+}
+
+// RemoveSession 移除会话，关闭连接处理器并通知任务管理器释放客户端资源
+func (sm *SessionManager) RemoveSession(sessionID string) {
+	sm.mu.Lock()
+	session, ok := sm.sessions[sessionID]
+	if ok {
+		delete(sm.sessions, sessionID)
+	}
+	count := len(sm.sessions)
+	sm.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if session.handler != nil {
+		session.handler.Close()
+	}
+	if sm.taskMgr != nil {
+		sm.taskMgr.RemoveClient(sessionID)
+	}
+
+	sm.logger.Info(fmt.Sprintf("会话已移除: %s, 设备: %s, 持续时间: %v, 当前会话数: %d",
+		sessionID, session.DeviceID, time.Since(session.CreatedAt).Round(time.Second), count))
+}
+
+// CloseDevice 关闭指定设备所有会话的底层连接，返回关闭的会话数
+// 设备解绑后已通过验证的会话不能继续使用，断开后设备重连时需重新激活
+func (sm *SessionManager) CloseDevice(deviceID string) int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	closed := 0
+	for _, session := range sm.sessions {
+		if session.DeviceID == deviceID && session.conn != nil {
+			session.conn.Close()
+			closed++
+		}
+	}
+	return closed
+}
+
+// CloseAll 关闭所有会话的底层连接，连接处理器退出后会自行移除会话
+func (sm *SessionManager) CloseAll() {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	for _, session := range sm.sessions {
+		if session.conn != nil {
+			session.conn.Close()
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"testing"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// fakeConn 只记录是否被关闭的连接
+type fakeConn struct {
+	closed bool
+}
+
+func (c *fakeConn) ReadMessage() (int, []byte, error) { return 0, nil, nil }
+func (c *fakeConn) WriteMessage(int, []byte) error    { return nil }
+func (c *fakeConn) Close() error                      { c.closed = true; return nil }
+
+func TestSessionManagerCloseDevice(t *testing.T) {
+	config := &configs.Config{}
+	config.Log.LogDir = t.TempDir()
+	config.Log.LogFile = "test.log"
+	logger, err := utils.NewLogger(config)
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	sm := NewSessionManager(logger, nil)
+
+	first, second, other := &fakeConn{}, &fakeConn{}, &fakeConn{}
+	sm.CreateSession("device-a", "client-1", "127.0.0.1", first, nil)
+	sm.CreateSession("device-a", "client-2", "127.0.0.1", second, nil)
+	sm.CreateSession("device-b", "client-3", "127.0.0.1", other, nil)
+
+	if n := sm.CloseDevice("device-a"); n != 2 {
+		t.Errorf("CloseDevice() = %d, want 2", n)
+	}
+	if !first.closed || !second.closed {
+		t.Error("device-a sessions not closed")
+	}
+	if other.closed {
+		t.Error("device-b session closed")
+	}
+	if n := sm.CloseDevice("unknown"); n != 0 {
+		t.Errorf("CloseDevice(unknown) = %d, want 0", n)
+	}
+}
@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"xiaozhi-server-go/src/core/types"
+)
+
+var weekdays = []string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+
+// WeekdayName 返回星期的中文名称，如星期一
+func WeekdayName(t time.Time) string {
+	return weekdays[t.Weekday()]
+}
+
+func init() {
+	// 查询当前时间，LLM本身不知道当前日期和时间
+	Register(&Tool{
+		Function: types.Function{
+			Name:        "get_current_time",
+			Description: "获取当前的日期、时间和星期，用户询问现在几点、今天几号、星期几时调用",
+			Parameters: types.FunctionParams{
+				Type:       "object",
+				Properties: map[string]types.ParamSchema{},
+			},
+		},
+		Execute: func(ctx context.Context, args map[string]interface{}) (*Result, error) {
+			now := time.Now()
+			return NewTextResult(fmt.Sprintf("当前时间: %s %s",
+				now.Format("2006年01月02日 15:04"), WeekdayName(now))), nil
+		},
+	})
+
+	// 用户想结束对话时由LLM调用，播报告别语后关闭连接
+	Register(&Tool{
+		Function: types.Function{
+			Name:        "handle_exit_intent",
+			Description: "当用户想结束对话或需要退出时调用",
+			Parameters: types.FunctionParams{
+				Type: "object",
+				Properties: map[string]types.ParamSchema{
+					"say_goodbye": {
+						Type:        "string",
+						Description: "和用户友好结束对话的告别语",
+					},
+				},
+				Required: []string{"say_goodbye"},
+			},
+		},
+		Execute: func(ctx context.Context, args map[string]interface{}) (*Result, error) {
+			goodbye, _ := args["say_goodbye"].(string)
+			if goodbye == "" {
+				goodbye = "再见"
+			}
+			return &Result{Action: ActionCloseChat, Content: "对话已结束", Response: goodbye}, nil
+		},
+	})
+}
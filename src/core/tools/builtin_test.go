@@ -0,0 +1,23 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWeekdayName(t *testing.T) {
+	tests := []struct {
+		date string
+		want string
+	}{
+		{"2024-05-05", "星期日"},
+		{"2024-05-06", "星期一"},
+		{"2024-05-11", "星期六"},
+	}
+	for _, tt := range tests {
+		date, _ := time.Parse("2006-01-02", tt.date)
+		if got := WeekdayName(date); got != tt.want {
+			t.Errorf("WeekdayName(%s) = %s, want %s", tt.date, got, tt.want)
+		}
+	}
+}
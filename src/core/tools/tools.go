@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+)
+
+// Action 工具执行后的处理方式
+type Action int
+
+const (
+	ActionReqLLM    Action = iota // 将结果交给LLM，由LLM生成回复
+	ActionResponse                // 直接播报Response，不再请求LLM
+	ActionCloseChat               // 播报Response后结束对话
+	ActionPlayAudio               // 播放AudioFile音频文件
+)
+
+// Result 工具执行结果
+type Result struct {
+	Action    Action
+	Content   string // 交给LLM的执行结果
+	Response  string // 直接播报给用户的文本
+	AudioFile string // 需要播放的音频文件
+}
+
+// NewTextResult 创建交给LLM处理的结果
+func NewTextResult(content string) *Result {
+	return &Result{Action: ActionReqLLM, Content: content}
+}
+
+// NewResponseResult 创建直接播报的结果
+func NewResponseResult(response string) *Result {
+	return &Result{Action: ActionResponse, Content: response, Response: response}
+}
+
+// Executor 工具执行函数，args已按函数定义校验
+type Executor func(ctx context.Context, args map[string]interface{}) (*Result, error)
+
+// Tool 可供LLM调用的工具
+type Tool struct {
+	Function types.Function
+	Execute  Executor
+}
+
+// Call 解析并校验LLM传入的参数后执行工具
+func (t *Tool) Call(ctx context.Context, arguments string) (*Result, error) {
+	arguments = strings.TrimSpace(arguments)
+	if arguments == "" {
+		arguments = "{}"
+	}
+	args, err := llm.ParseFunctionArguments(arguments)
+	if err != nil {
+		return nil, err
+	}
+	if err := llm.ValidateFunctionArguments(t.Function.Parameters, args); err != nil {
+		return nil, err
+	}
+
+	result, err := t.Execute(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = NewTextResult("")
+	}
+	return result, nil
+}
+
+var (
+	registry = make(map[string]*Tool)
+	mu       sync.RWMutex
+)
+
+// Register 注册服务端工具
+func Register(tool *Tool) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[tool.Function.Name] = tool
+}
+
+// Get 获取已注册的工具
+func Get(name string) (*Tool, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	tool, ok := registry[name]
+	return tool, ok
+}
+
+// List 列出所有已注册的工具名称
+func List() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve 根据配置中启用的工具名称获取工具
+func Resolve(names []string) ([]*Tool, error) {
+	result := make([]*Tool, 0, len(names))
+	for _, name := range names {
+		tool, ok := Get(name)
+		if !ok {
+			return nil, fmt.Errorf("未知的工具: %s", name)
+		}
+		result = append(result, tool)
+	}
+	return result, nil
+}
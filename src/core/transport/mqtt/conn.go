@@ -0,0 +1,243 @@
+package mqtt
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrConnClosed 连接已关闭
+var ErrConnClosed = errors.New("MQTT连接已关闭")
+
+const (
+	textMessage   = 1
+	binaryMessage = 2
+
+	// udpSeqWindow 允许的最大序号跳跃，超过时视为伪造的包，约为一分钟的音频帧
+	udpSeqWindow = 1000
+)
+
+type message struct {
+	messageType int
+	data        []byte
+}
+
+// Conn MQTT+UDP连接，控制消息走MQTT，音频数据走加密UDP
+// 实现与WebSocket连接相同的ReadMessage/WriteMessage/Close接口，供ConnectionHandler复用
+type Conn struct {
+	gateway    *Gateway
+	clientID   string // MQTT客户端ID
+	deviceID   string
+	uuid       string
+	remoteIP   string
+	replyTopic string
+
+	// UDP会话
+	connID    uint32
+	key       []byte
+	nonce     []byte
+	udpAddr   *net.UDPAddr
+	localSeq  uint32
+	remoteSeq uint32
+	startTime time.Time
+	udpMu     sync.Mutex
+
+	incoming  chan message
+	closeChan chan struct{}
+	closeOnce sync.Once
+}
+
+func newConn(g *Gateway, clientID, remoteIP string, connID uint32) (*Conn, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("生成UDP密钥失败: %v", err)
+	}
+
+	// nonce格式: [类型1B][保留1B][长度2B][连接ID 4B][时间戳4B][序号4B]
+	nonce := make([]byte, 16)
+	nonce[0] = 0x01
+	binary.BigEndian.PutUint32(nonce[4:8], connID)
+
+	deviceID, uuid := parseClientID(clientID)
+	return &Conn{
+		gateway:    g,
+		clientID:   clientID,
+		deviceID:   deviceID,
+		uuid:       uuid,
+		remoteIP:   remoteIP,
+		replyTopic: DeviceTopic(deviceID),
+		connID:     connID,
+		key:        key,
+		nonce:      nonce,
+		startTime:  time.Now(),
+		incoming:   make(chan message, 100),
+		closeChan:  make(chan struct{}),
+	}, nil
+}
+
+// DeviceID 设备ID(MAC地址)
+func (c *Conn) DeviceID() string {
+	return c.deviceID
+}
+
+// ClientID 设备上报的客户端UUID
+func (c *Conn) ClientID() string {
+	return c.uuid
+}
+
+// RemoteIP 设备IP
+func (c *Conn) RemoteIP() string {
+	return c.remoteIP
+}
+
+// ReadMessage 读取设备消息，MQTT消息为文本消息，UDP音频为二进制消息
+func (c *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	select {
+	case msg := <-c.incoming:
+		return msg.messageType, msg.data, nil
+	case <-c.closeChan:
+		return 0, nil, ErrConnClosed
+	}
+}
+
+// WriteMessage 文本消息通过MQTT发布到设备主题，二进制消息通过UDP发送
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	select {
+	case <-c.closeChan:
+		return ErrConnClosed
+	default:
+	}
+
+	switch messageType {
+	case textMessage:
+		return c.gateway.publish(c.replyTopic, data)
+	case binaryMessage:
+		return c.sendAudio(data)
+	default:
+		return fmt.Errorf("不支持的消息类型: %d", messageType)
+	}
+}
+
+// Close 关闭连接并通知设备关闭音频通道
+func (c *Conn) Close() error {
+	c.close(true)
+	return nil
+}
+
+// close 关闭连接，notify为false时不向设备发送goodbye（设备已断开或已开启新会话）
+func (c *Conn) close(notify bool) {
+	c.closeOnce.Do(func() {
+		if notify {
+			goodbye, _ := json.Marshal(map[string]interface{}{"type": "goodbye"})
+			c.gateway.publish(c.replyTopic, goodbye)
+		}
+		close(c.closeChan)
+		c.gateway.removeConn(c)
+	})
+}
+
+// TransportType 传输类型，写入hello消息
+func (c *Conn) TransportType() string {
+	return "udp"
+}
+
+// HelloParams hello消息中附加的UDP通道参数
+func (c *Conn) HelloParams() map[string]interface{} {
+	return map[string]interface{}{
+		"udp": map[string]interface{}{
+			"server":     c.gateway.publicUDPHost,
+			"port":       c.gateway.udpPort,
+			"encryption": "aes-128-ctr",
+			"key":        hex.EncodeToString(c.key),
+			"nonce":      hex.EncodeToString(c.nonce),
+		},
+	}
+}
+
+// push 将设备消息放入读取队列，连接关闭后丢弃
+func (c *Conn) push(messageType int, data []byte) {
+	select {
+	case c.incoming <- message{messageType: messageType, data: data}:
+	case <-c.closeChan:
+	default:
+		c.gateway.logger.Warn(fmt.Sprintf("MQTT连接消息队列已满，丢弃消息: %s", c.clientID))
+	}
+}
+
+// sendAudio 加密并通过UDP发送音频数据
+func (c *Conn) sendAudio(data []byte) error {
+	c.udpMu.Lock()
+	addr := c.udpAddr
+	c.localSeq++
+	seq := c.localSeq
+	c.udpMu.Unlock()
+
+	if addr == nil {
+		// 设备尚未发送过UDP数据，无法确定其地址
+		return nil
+	}
+
+	header := make([]byte, 16)
+	copy(header, c.nonce)
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(data)))
+	binary.BigEndian.PutUint32(header[8:12], uint32(time.Since(c.startTime).Milliseconds()))
+	binary.BigEndian.PutUint32(header[12:16], seq)
+
+	encrypted, err := aesCTR(c.key, header, data)
+	if err != nil {
+		return err
+	}
+	return c.gateway.udp.send(append(header, encrypted...), addr)
+}
+
+// handleUDPPacket 处理设备发来的UDP音频包
+// 包头中的连接ID是明文，只有解密后为合法Opus帧、序号在窗口内的包才会被接受；
+// 第一个合法包的来源地址即为设备地址，之后其他地址的包一律丢弃，设备地址变化时需重新发送hello
+func (c *Conn) handleUDPPacket(header []byte, payload []byte, addr *net.UDPAddr) {
+	seq := binary.BigEndian.Uint32(header[12:16])
+
+	c.udpMu.Lock()
+	bound := c.udpAddr
+	lastSeq := c.remoteSeq
+	c.udpMu.Unlock()
+	if bound != nil && !sameUDPAddr(bound, addr) {
+		return
+	}
+	if seq <= lastSeq || seq-lastSeq > udpSeqWindow {
+		return // 丢弃重复、乱序或序号跳跃过大的包
+	}
+
+	decrypted, err := aesCTR(c.key, header, payload)
+	if err != nil {
+		c.gateway.logger.Error(fmt.Sprintf("UDP音频解密失败: %v", err))
+		return
+	}
+	if !validOpusPacket(decrypted) {
+		return
+	}
+
+	c.udpMu.Lock()
+	// 解密期间可能已接受了其他包，重新检查
+	if (c.udpAddr != nil && !sameUDPAddr(c.udpAddr, addr)) || seq <= c.remoteSeq {
+		c.udpMu.Unlock()
+		return
+	}
+	if c.udpAddr == nil {
+		c.udpAddr = addr
+	}
+	c.remoteSeq = seq
+	c.udpMu.Unlock()
+
+	c.push(binaryMessage, decrypted)
+}
+
+// sameUDPAddr 判断两个UDP地址是否相同
+func sameUDPAddr(a, b *net.UDPAddr) bool {
+	return a.IP.Equal(b.IP) && a.Port == b.Port
+}
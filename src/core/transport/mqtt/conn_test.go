@@ -0,0 +1,120 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// opusFrame 20ms的CELT单帧Opus包
+var opusFrame = []byte{0xf8, 0x01, 0x02, 0x03}
+
+// devicePacket 按设备的方式加密音频帧，返回包头和密文
+func devicePacket(t *testing.T, c *Conn, seq uint32, frame []byte) ([]byte, []byte) {
+	t.Helper()
+	header := make([]byte, 16)
+	copy(header, c.nonce)
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(frame)))
+	binary.BigEndian.PutUint32(header[12:16], seq)
+	encrypted, err := aesCTR(c.key, header, frame)
+	if err != nil {
+		t.Fatalf("aesCTR() error = %v", err)
+	}
+	return header, encrypted
+}
+
+func TestHandleUDPPacket(t *testing.T) {
+	deviceAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 10), Port: 40000}
+	spoofAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 50000}
+
+	tests := []struct {
+		name   string
+		seq    uint32
+		addr   *net.UDPAddr
+		frame  []byte
+		accept bool
+	}{
+		{"第一个合法包绑定地址", 1, deviceAddr, opusFrame, true},
+		{"其他地址的合法序号", 2, spoofAddr, opusFrame, false},
+		{"重复序号", 1, deviceAddr, opusFrame, false},
+		{"序号跳跃过大", 1 + udpSeqWindow + 1, deviceAddr, opusFrame, false},
+		{"解密后不是Opus帧", 2, deviceAddr, []byte{0xf9, 0x01, 0x02, 0x03}, false},
+		{"后续合法包", 2, deviceAddr, opusFrame, true},
+		{"窗口内跳跃", 2 + udpSeqWindow, deviceAddr, opusFrame, true},
+	}
+
+	c, err := newConn(&Gateway{}, ClientIDForDevice("aa:bb:cc:dd:ee:ff", "uuid"), "192.168.1.10", 0x12345678)
+	if err != nil {
+		t.Fatalf("newConn() error = %v", err)
+	}
+	for _, tt := range tests {
+		header, payload := devicePacket(t, c, tt.seq, tt.frame)
+		c.handleUDPPacket(header, payload, tt.addr)
+
+		select {
+		case msg := <-c.incoming:
+			if !tt.accept {
+				t.Errorf("%s: packet accepted, want dropped", tt.name)
+			} else if !bytes.Equal(msg.data, tt.frame) {
+				t.Errorf("%s: decrypted = %x, want %x", tt.name, msg.data, tt.frame)
+			}
+		default:
+			if tt.accept {
+				t.Errorf("%s: packet dropped, want accepted", tt.name)
+			}
+		}
+		if !sameUDPAddr(c.udpAddr, deviceAddr) {
+			t.Fatalf("%s: udpAddr = %v, want %v", tt.name, c.udpAddr, deviceAddr)
+		}
+	}
+}
+
+func TestValidOpusPacket(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"空包", nil, false},
+		{"单帧", []byte{0xf8, 0x01}, true},
+		{"单帧过长", append([]byte{0xf8}, make([]byte, 1276)...), false},
+		{"两个等长帧", []byte{0xf9, 0x01, 0x02}, true},
+		{"两个等长帧长度为奇数", []byte{0xf9, 0x01, 0x02, 0x03}, false},
+		{"两个不等长帧", []byte{0xfa, 0x01, 0xaa, 0xbb, 0xcc}, true},
+		{"不等长帧长度越界", []byte{0xfa, 0x05, 0xaa}, false},
+		{"CBR多帧", []byte{0xfb, 0x03, 0x01, 0x02, 0x03}, true},
+		{"CBR多帧长度不整除", []byte{0xfb, 0x03, 0x01, 0x02}, false},
+		{"帧数为0", []byte{0xfb, 0x00}, false},
+		{"总时长超过120ms", []byte{0xfb, 0x07}, false},
+		{"VBR多帧", []byte{0xfb, 0x82, 0x01, 0xaa, 0xbb}, true},
+		{"VBR帧长度越界", []byte{0xfb, 0x82, 0x05, 0xaa}, false},
+		{"带填充", []byte{0xfb, 0x41, 0x02, 0xaa, 0x00, 0x00}, true},
+		{"填充长度越界", []byte{0xfb, 0x41, 0x05, 0xaa}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validOpusPacket(tt.data); got != tt.want {
+				t.Errorf("validOpusPacket(%x) = %v, want %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewConnIDRandom(t *testing.T) {
+	g := &Gateway{conns: make(map[string]*Conn), connsByID: make(map[uint32]*Conn)}
+	first, err := g.addConn("client-a", "192.168.1.10")
+	if err != nil {
+		t.Fatalf("addConn() error = %v", err)
+	}
+	second, err := g.addConn("client-b", "192.168.1.11")
+	if err != nil {
+		t.Fatalf("addConn() error = %v", err)
+	}
+	if first.connID == 0 || second.connID == 0 || first.connID == second.connID {
+		t.Errorf("connIDs = %d, %d, want distinct non-zero", first.connID, second.connID)
+	}
+	if first.connID == 1 && second.connID == 2 {
+		t.Error("connIDs are sequential")
+	}
+}
@@ -0,0 +1,314 @@
+package mqtt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/utils"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+const (
+	// PublishTopic 设备上行消息主题
+	PublishTopic = "device-server"
+	// deviceTopicPrefix 下行消息主题前缀，后接设备MAC(冒号替换为下划线)
+	deviceTopicPrefix = "devices/p2p/"
+	// clientIDGroup 下发给设备的MQTT客户端ID分组
+	clientIDGroup = "GID_default"
+)
+
+// AuthFunc 设备连接认证回调，token为MQTT连接密码
+type AuthFunc func(deviceID, token string) error
+
+// SessionFunc 设备发送hello后建立会话的回调
+type SessionFunc func(conn *Conn)
+
+// Gateway MQTT+UDP接入网关
+// 内置MQTT broker接收设备控制消息，UDP服务接收和发送加密音频
+// 目前只支持内置broker，接入外部broker需要独立的MQTT客户端，尚未实现
+type Gateway struct {
+	config        *configs.Config
+	logger        *utils.Logger
+	broker        *mochi.Server
+	udp           *udpServer
+	publicUDPHost string
+	udpPort       int
+
+	authenticate AuthFunc
+	onSession    SessionFunc
+
+	conns     map[string]*Conn // MQTT客户端ID -> 连接
+	connsByID map[uint32]*Conn // UDP连接ID -> 连接
+	mu        sync.RWMutex
+}
+
+// NewGateway 创建MQTT网关
+func NewGateway(config *configs.Config, logger *utils.Logger, authenticate AuthFunc, onSession SessionFunc) *Gateway {
+	publicUDPHost := config.MQTT.UDP.PublicIP
+	if publicUDPHost == "" {
+		publicUDPHost = utils.GetLocalIP()
+	}
+	return &Gateway{
+		config:        config,
+		logger:        logger,
+		publicUDPHost: publicUDPHost,
+		udpPort:       config.MQTT.UDP.Port,
+		authenticate:  authenticate,
+		onSession:     onSession,
+		conns:         make(map[string]*Conn),
+		connsByID:     make(map[uint32]*Conn),
+	}
+}
+
+// Start 启动MQTT broker和UDP服务
+func (g *Gateway) Start() error {
+	udpAddr := fmt.Sprintf("%s:%d", g.config.MQTT.UDP.IP, g.config.MQTT.UDP.Port)
+	udp, err := newUDPServer(g, udpAddr)
+	if err != nil {
+		return err
+	}
+	g.udp = udp
+	go g.udp.serve()
+
+	g.broker = mochi.New(&mochi.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn})),
+	})
+	if err := g.broker.AddHook(&gatewayHook{gateway: g}, nil); err != nil {
+		g.udp.close()
+		return fmt.Errorf("添加MQTT钩子失败: %v", err)
+	}
+
+	mqttAddr := fmt.Sprintf("%s:%d", g.config.MQTT.IP, g.config.MQTT.Port)
+	tcp := listeners.NewTCP(listeners.Config{ID: "xiaozhi-mqtt", Address: mqttAddr})
+	if err := g.broker.AddListener(tcp); err != nil {
+		g.udp.close()
+		return fmt.Errorf("MQTT监听失败: %v", err)
+	}
+	if err := g.broker.Serve(); err != nil {
+		g.udp.close()
+		return fmt.Errorf("启动MQTT服务失败: %v", err)
+	}
+
+	g.logger.Info(fmt.Sprintf("MQTT网关已启动, MQTT: %s, UDP: %s", mqttAddr, udpAddr))
+	return nil
+}
+
+// Stop 关闭所有连接并停止服务
+func (g *Gateway) Stop() error {
+	g.mu.RLock()
+	conns := make([]*Conn, 0, len(g.conns))
+	for _, c := range g.conns {
+		conns = append(conns, c)
+	}
+	g.mu.RUnlock()
+	for _, c := range conns {
+		c.Close()
+	}
+
+	var lastErr error
+	if g.broker != nil {
+		if err := g.broker.Close(); err != nil {
+			lastErr = err
+		}
+	}
+	if g.udp != nil {
+		if err := g.udp.close(); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// handleDeviceMessage 处理设备通过MQTT上报的消息
+func (g *Gateway) handleDeviceMessage(clientID, remoteIP string, payload []byte) {
+	var msg struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		g.logger.Warn(fmt.Sprintf("MQTT消息解析失败: %s, %v", clientID, err))
+		return
+	}
+
+	switch msg.Type {
+	case "hello":
+		// 每次hello都开启新的音频会话，旧会话直接关闭
+		if old := g.getConn(clientID); old != nil {
+			old.close(false)
+		}
+		c, err := g.addConn(clientID, remoteIP)
+		if err != nil {
+			g.logger.Error(fmt.Sprintf("创建MQTT连接失败: %v", err))
+			return
+		}
+		c.push(textMessage, payload)
+		g.onSession(c)
+	case "goodbye":
+		if c := g.getConn(clientID); c != nil {
+			c.close(false)
+		}
+	default:
+		c := g.getConn(clientID)
+		if c == nil {
+			g.logger.Warn(fmt.Sprintf("MQTT客户端%s尚未发送hello，忽略消息: %s", clientID, msg.Type))
+			return
+		}
+		c.push(textMessage, payload)
+	}
+}
+
+func (g *Gateway) addConn(clientID, remoteIP string) (*Conn, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	connID, err := g.newConnID()
+	if err != nil {
+		return nil, err
+	}
+	c, err := newConn(g, clientID, remoteIP, connID)
+	if err != nil {
+		return nil, err
+	}
+	g.conns[clientID] = c
+	g.connsByID[c.connID] = c
+	return c, nil
+}
+
+// newConnID 随机生成未被占用的UDP连接ID，连接ID写在明文包头中，不能被轻易猜到，调用方需持有锁
+func (g *Gateway) newConnID() (uint32, error) {
+	var b [4]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, fmt.Errorf("生成UDP连接ID失败: %v", err)
+		}
+		connID := binary.BigEndian.Uint32(b[:])
+		if _, exists := g.connsByID[connID]; connID != 0 && !exists {
+			return connID, nil
+		}
+	}
+}
+
+func (g *Gateway) removeConn(c *Conn) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if current, ok := g.conns[c.clientID]; ok && current == c {
+		delete(g.conns, c.clientID)
+	}
+	delete(g.connsByID, c.connID)
+}
+
+func (g *Gateway) getConn(clientID string) *Conn {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.conns[clientID]
+}
+
+func (g *Gateway) connByID(connID uint32) *Conn {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.connsByID[connID]
+}
+
+// publish 通过内置客户端向设备主题发布消息
+func (g *Gateway) publish(topic string, data []byte) error {
+	if g.broker == nil {
+		return fmt.Errorf("MQTT服务未启动")
+	}
+	return g.broker.Publish(topic, data, false, 0)
+}
+
+// gatewayHook MQTT broker钩子，负责认证和转发设备消息
+type gatewayHook struct {
+	mochi.HookBase
+	gateway *Gateway
+}
+
+func (h *gatewayHook) ID() string {
+	return "xiaozhi-gateway"
+}
+
+func (h *gatewayHook) Provides(b byte) bool {
+	return bytes.Contains([]byte{
+		mochi.OnConnectAuthenticate,
+		mochi.OnACLCheck,
+		mochi.OnPublish,
+		mochi.OnDisconnect,
+	}, []byte{b})
+}
+
+func (h *gatewayHook) OnConnectAuthenticate(cl *mochi.Client, pk packets.Packet) bool {
+	if h.gateway.authenticate == nil {
+		return true
+	}
+	deviceID, _ := parseClientID(cl.ID)
+	if err := h.gateway.authenticate(deviceID, string(pk.Connect.Password)); err != nil {
+		h.gateway.logger.Warn(fmt.Sprintf("MQTT设备认证失败: %v, 客户端: %s", err, cl.ID))
+		return false
+	}
+	return true
+}
+
+// OnACLCheck 设备只能向上行主题发布消息，只能订阅自己的下行主题
+// 下行主题的hello回复中带有UDP加密密钥，不能被其他客户端订阅
+func (h *gatewayHook) OnACLCheck(cl *mochi.Client, topic string, write bool) bool {
+	if cl.Net.Inline {
+		return true
+	}
+	if write {
+		return topic == PublishTopic
+	}
+	deviceID, uuid := parseClientID(cl.ID)
+	if uuid == "" {
+		return false
+	}
+	return topic == DeviceTopic(deviceID)
+}
+
+func (h *gatewayHook) OnPublish(cl *mochi.Client, pk packets.Packet) (packets.Packet, error) {
+	if pk.TopicName == PublishTopic && !cl.Net.Inline {
+		host, _, err := net.SplitHostPort(cl.Net.Remote)
+		if err != nil {
+			host = cl.Net.Remote
+		}
+		h.gateway.handleDeviceMessage(cl.ID, host, pk.Payload)
+	}
+	return pk, nil
+}
+
+func (h *gatewayHook) OnDisconnect(cl *mochi.Client, err error, expire bool) {
+	if c := h.gateway.getConn(cl.ID); c != nil {
+		c.close(false)
+	}
+}
+
+// parseClientID 解析形如 GID_xxx@@@aa_bb_cc_dd_ee_ff@@@uuid 的客户端ID，返回设备MAC和UUID
+func parseClientID(clientID string) (string, string) {
+	parts := strings.Split(clientID, "@@@")
+	if len(parts) != 3 {
+		return clientID, ""
+	}
+	return strings.ReplaceAll(parts[1], "_", ":"), parts[2]
+}
+
+// ClientIDForDevice 生成下发给设备的MQTT客户端ID
+func ClientIDForDevice(deviceID, uuid string) string {
+	return fmt.Sprintf("%s@@@%s@@@%s", clientIDGroup, strings.ReplaceAll(deviceID, ":", "_"), uuid)
+}
+
+// DeviceTopic 设备订阅的下行消息主题
+func DeviceTopic(deviceID string) string {
+	return deviceTopicPrefix + strings.ReplaceAll(deviceID, ":", "_")
+}
@@ -0,0 +1,82 @@
+package mqtt
+
+import (
+	"testing"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+)
+
+func TestParseClientID(t *testing.T) {
+	tests := []struct {
+		clientID string
+		wantMAC  string
+		wantUUID string
+	}{
+		{"GID_test@@@aa_bb_cc_dd_ee_ff@@@uuid-1", "aa:bb:cc:dd:ee:ff", "uuid-1"},
+		{"GID_test@@@aa_bb_cc_dd_ee_ff@@@", "aa:bb:cc:dd:ee:ff", ""},
+		{"aa:bb:cc:dd:ee:ff", "aa:bb:cc:dd:ee:ff", ""},
+		{"GID_test@@@aa_bb_cc_dd_ee_ff", "GID_test@@@aa_bb_cc_dd_ee_ff", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		mac, uuid := parseClientID(tt.clientID)
+		if mac != tt.wantMAC || uuid != tt.wantUUID {
+			t.Errorf("parseClientID(%q) = %q, %q, want %q, %q", tt.clientID, mac, uuid, tt.wantMAC, tt.wantUUID)
+		}
+	}
+}
+
+func TestClientIDForDevice(t *testing.T) {
+	tests := []struct {
+		deviceID string
+		uuid     string
+	}{
+		{"aa:bb:cc:dd:ee:ff", "uuid-1"},
+		{"11:22:33:44:55:66", "0f8e7d6c"},
+	}
+	for _, tt := range tests {
+		clientID := ClientIDForDevice(tt.deviceID, tt.uuid)
+		mac, uuid := parseClientID(clientID)
+		if mac != tt.deviceID || uuid != tt.uuid {
+			t.Errorf("parseClientID(ClientIDForDevice(%q, %q)) = %q, %q", tt.deviceID, tt.uuid, mac, uuid)
+		}
+	}
+}
+
+func TestDeviceTopic(t *testing.T) {
+	if got, want := DeviceTopic("aa:bb:cc:dd:ee:ff"), "devices/p2p/aa_bb_cc_dd_ee_ff"; got != want {
+		t.Errorf("DeviceTopic() = %q, want %q", got, want)
+	}
+}
+
+func TestOnACLCheck(t *testing.T) {
+	hook := &gatewayHook{}
+	device := ClientIDForDevice("aa:bb:cc:dd:ee:ff", "uuid-1")
+
+	tests := []struct {
+		name     string
+		clientID string
+		inline   bool
+		topic    string
+		write    bool
+		want     bool
+	}{
+		{"发布上行主题", device, false, PublishTopic, true, true},
+		{"发布其他主题", device, false, "devices/p2p/aa_bb_cc_dd_ee_ff", true, false},
+		{"订阅自己的下行主题", device, false, "devices/p2p/aa_bb_cc_dd_ee_ff", false, true},
+		{"订阅其他设备的下行主题", device, false, "devices/p2p/11_22_33_44_55_66", false, false},
+		{"订阅通配符主题", device, false, "devices/p2p/#", false, false},
+		{"订阅上行主题", device, false, PublishTopic, false, false},
+		{"客户端ID缺少UUID", "aa:bb:cc:dd:ee:ff", false, "devices/p2p/aa:bb:cc:dd:ee:ff", false, false},
+		{"内置客户端", "inline", true, "devices/p2p/11_22_33_44_55_66", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := &mochi.Client{ID: tt.clientID}
+			cl.Net.Inline = tt.inline
+			if got := hook.OnACLCheck(cl, tt.topic, tt.write); got != tt.want {
+				t.Errorf("OnACLCheck(%q, %q, %v) = %v, want %v", tt.clientID, tt.topic, tt.write, got, tt.want)
+			}
+		})
+	}
+}
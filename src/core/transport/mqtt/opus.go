@@ -0,0 +1,105 @@
+package mqtt
+
+const (
+	// maxOpusFrameSize 单个Opus帧的最大字节数
+	maxOpusFrameSize = 1275
+	// maxOpusPacketDuration 单个Opus包的最大时长，单位0.1ms
+	maxOpusPacketDuration = 1200
+)
+
+// opusFrameDuration 根据TOC字节返回每帧时长，单位0.1ms
+func opusFrameDuration(toc byte) int {
+	config := int(toc >> 3)
+	switch {
+	case config < 12: // SILK
+		return []int{100, 200, 400, 600}[config%4]
+	case config < 16: // Hybrid
+		return []int{100, 200}[config%2]
+	default: // CELT
+		return []int{25, 50, 100, 200}[config%4]
+	}
+}
+
+// opusFrameLength 解析帧长度字段，返回长度和字段占用的字节数
+func opusFrameLength(data []byte) (int, int, bool) {
+	if len(data) < 1 {
+		return 0, 0, false
+	}
+	if data[0] < 252 {
+		return int(data[0]), 1, true
+	}
+	if len(data) < 2 {
+		return 0, 0, false
+	}
+	return int(data[0]) + 4*int(data[1]), 2, true
+}
+
+// validOpusPacket 按RFC 6716第3.4节检查Opus包结构是否合法
+// UDP包头未经认证，用于丢弃无法解密为Opus帧的伪造包
+func validOpusPacket(data []byte) bool {
+	if len(data) < 1 {
+		return false
+	}
+	toc := data[0]
+	rest := data[1:]
+
+	switch toc & 0x03 {
+	case 0: // 单帧
+		return len(rest) <= maxOpusFrameSize
+	case 1: // 两个等长帧
+		return len(rest)%2 == 0 && len(rest)/2 <= maxOpusFrameSize
+	case 2: // 两个不等长帧
+		size, n, ok := opusFrameLength(rest)
+		if !ok || size > len(rest)-n {
+			return false
+		}
+		return size <= maxOpusFrameSize && len(rest)-n-size <= maxOpusFrameSize
+	}
+
+	// 任意帧数
+	if len(rest) < 1 {
+		return false
+	}
+	vbr := rest[0]&0x80 != 0
+	padded := rest[0]&0x40 != 0
+	count := int(rest[0] & 0x3f)
+	rest = rest[1:]
+	if count == 0 || count*opusFrameDuration(toc) > maxOpusPacketDuration {
+		return false
+	}
+
+	padding := 0
+	for padded {
+		if len(rest) < 1 {
+			return false
+		}
+		b := int(rest[0])
+		rest = rest[1:]
+		if b == 255 {
+			padding += 254
+		} else {
+			padding += b
+			padded = false
+		}
+	}
+	if padding > len(rest) {
+		return false
+	}
+	remaining := len(rest) - padding
+
+	if !vbr {
+		return remaining%count == 0 && remaining/count <= maxOpusFrameSize
+	}
+	for i := 0; i < count-1; i++ {
+		size, n, ok := opusFrameLength(rest)
+		if !ok || size > maxOpusFrameSize {
+			return false
+		}
+		rest = rest[n:]
+		remaining -= n + size
+		if remaining < 0 {
+			return false
+		}
+	}
+	return remaining <= maxOpusFrameSize
+}
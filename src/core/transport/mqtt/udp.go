@@ -0,0 +1,80 @@
+package mqtt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// udpServer 加密UDP音频通道
+type udpServer struct {
+	gateway *Gateway
+	conn    *net.UDPConn
+}
+
+func newUDPServer(g *Gateway, addr string) (*udpServer, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("解析UDP地址失败: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("UDP监听失败: %v", err)
+	}
+	return &udpServer{gateway: g, conn: conn}, nil
+}
+
+// serve 接收设备音频包，根据nonce中的连接ID分发到对应连接
+func (u *udpServer) serve() {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := u.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return // 监听已关闭
+		}
+		if n < 16 || buf[0] != 0x01 {
+			continue
+		}
+
+		header := make([]byte, 16)
+		copy(header, buf[:16])
+		size := int(binary.BigEndian.Uint16(header[2:4]))
+		if 16+size > n {
+			continue
+		}
+
+		c := u.gateway.connByID(binary.BigEndian.Uint32(header[4:8]))
+		if c == nil {
+			continue
+		}
+
+		payload := make([]byte, size)
+		copy(payload, buf[16:16+size])
+		c.handleUDPPacket(header, payload, addr)
+	}
+}
+
+func (u *udpServer) send(data []byte, addr *net.UDPAddr) error {
+	_, err := u.conn.WriteToUDP(data, addr)
+	return err
+}
+
+func (u *udpServer) close() error {
+	return u.conn.Close()
+}
+
+// aesCTR 使用AES-128-CTR加解密，nonce即包头
+func aesCTR(key, nonce, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建AES加密器失败: %v", err)
+	}
+	out := make([]byte, len(data))
+	cipher.NewCTR(block, nonce).XORKeyStream(out, data)
+	return out, nil
+}
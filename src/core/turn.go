@@ -0,0 +1,161 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-server-go/src/core/chat"
+)
+
+const (
+	// turnWaitTimeout 开始新一轮对话时等待上一轮退出的最长时间
+	turnWaitTimeout = 5 * time.Second
+	// interruptedMarker 被打断的回复在对话历史中的标记
+	interruptedMarker = "……（回复被用户打断）"
+)
+
+// chatTurn 一轮对话，每次用户输入开始新的一轮
+// 打断、实时模式下的插话或新的用户输入会取消当前一轮，正在进行的LLM请求、语音合成和播放随之停止
+type chatTurn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{} // 本轮的对话处理(不含语音播放)结束后关闭
+
+	reply     string   // 写入对话历史的回复
+	replied   bool     // 本轮是否向对话历史写入了回复
+	spoken    []string // 设备已播放的文本
+	completed bool     // 本轮语音已全部播放完毕
+	mu        sync.Mutex
+
+	pendingAudio int           // 本轮尚未下发结束的音频任务数
+	audioIdle    chan struct{} // pendingAudio归零时关闭
+}
+
+type turnContextKey struct{}
+
+// turnFromContext 获取ctx所属的一轮对话
+func turnFromContext(ctx context.Context) *chatTurn {
+	turn, _ := ctx.Value(turnContextKey{}).(*chatTurn)
+	return turn
+}
+
+// startTurn 开始新一轮对话，取消上一轮并等待其对话处理退出
+// 上一轮的回复未播放完就被打断时，对话历史中的回复改为用户实际听到的部分并标记为被打断
+func (h *ConnectionHandler) startTurn(parent context.Context) (context.Context, *chatTurn) {
+	turn := &chatTurn{done: make(chan struct{})}
+	turn.ctx, turn.cancel = context.WithCancel(context.WithValue(parent, turnContextKey{}, turn))
+
+	h.turnMu.Lock()
+	prev := h.turn
+	h.turn = turn
+	h.turnMu.Unlock()
+
+	if prev != nil {
+		prev.cancel()
+		// 对话处理退出后，还要等音频发送协程记录被打断句子的已播放部分
+		waitCtx, cancel := context.WithTimeout(context.Background(), turnWaitTimeout)
+		select {
+		case <-prev.done:
+		case <-waitCtx.Done():
+		}
+		select {
+		case <-prev.audioSettled():
+		case <-waitCtx.Done():
+		}
+		if waitCtx.Err() != nil {
+			h.logger.Warn("等待上一轮对话结束超时")
+		}
+		cancel()
+		if heard, ok := prev.interrupted(); ok {
+			h.logger.Info(fmt.Sprintf("上一轮回复被打断，用户已听到: %s", heard))
+			h.dialogueManager.UpdateLast("assistant", heard+interruptedMarker)
+		}
+	}
+	return turn.ctx, turn
+}
+
+// endTurn 本轮对话处理结束，语音可能仍在播放
+func (h *ConnectionHandler) endTurn(turn *chatTurn) {
+	close(turn.done)
+}
+
+// cancelTurn 取消当前一轮对话
+func (h *ConnectionHandler) cancelTurn() {
+	h.turnMu.Lock()
+	turn := h.turn
+	h.turnMu.Unlock()
+	if turn != nil {
+		turn.cancel()
+	}
+}
+
+// putAssistantReply 将本轮的回复写入对话历史
+func (h *ConnectionHandler) putAssistantReply(ctx context.Context, content string) {
+	h.dialogueManager.Put(chat.Message{
+		Role:    "assistant",
+		Content: content,
+	})
+	if turn := turnFromContext(ctx); turn != nil {
+		turn.mu.Lock()
+		turn.reply, turn.replied = content, true
+		turn.mu.Unlock()
+	}
+}
+
+// addSpoken 记录设备已播放的文本
+func (t *chatTurn) addSpoken(text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spoken = append(t.spoken, text)
+}
+
+// addAudio 本轮新增一个音频任务
+func (t *chatTurn) addAudio() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pendingAudio++
+}
+
+// doneAudio 音频任务下发结束，已播放的文本此前已通过addSpoken记录
+func (t *chatTurn) doneAudio() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pendingAudio--
+	if t.pendingAudio == 0 && t.audioIdle != nil {
+		close(t.audioIdle)
+		t.audioIdle = nil
+	}
+}
+
+// audioSettled 返回的通道在本轮所有音频任务下发结束后关闭
+func (t *chatTurn) audioSettled() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ch := make(chan struct{})
+	if t.pendingAudio == 0 {
+		close(ch)
+		return ch
+	}
+	t.audioIdle = ch
+	return ch
+}
+
+// markCompleted 本轮语音已全部播放
+func (t *chatTurn) markCompleted() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.completed = true
+}
+
+// interrupted 本轮回复是否未播放完就被打断，返回用户已听到的文本
+func (t *chatTurn) interrupted() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.replied || t.completed || t.reply == "" {
+		return "", false
+	}
+	return strings.Join(t.spoken, ""), true
+}
@@ -12,6 +12,7 @@ type Message struct {
 
 // ToolCall 工具调用结构
 type ToolCall struct {
+	Index    int          `json:"index"` // 流式输出时用于合并同一调用的分片
 	ID       string       `json:"id"`
 	Type     string       `json:"type"`
 	Function FunctionCall `json:"function"`
@@ -34,9 +35,10 @@ type FunctionParams struct {
 
 // ParamSchema 参数模式定义
 type ParamSchema struct {
-	Type        string   `json:"type"`
-	Description string   `json:"description,omitempty"`
-	Enum        []string `json:"enum,omitempty"`
+	Type        string       `json:"type"`
+	Description string       `json:"description,omitempty"`
+	Enum        []string     `json:"enum,omitempty"`
+	Items       *ParamSchema `json:"items,omitempty"` // 数组元素类型
 }
 
 // FunctionCall 函数调用结果
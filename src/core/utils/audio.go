@@ -65,6 +65,10 @@ func (d *OpusDecoder) Decode(opusData []byte) ([]byte, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
+	if d.decoder == nil {
+		return nil, fmt.Errorf("Opus解码器已关闭")
+	}
+
 	// 使用预分配的缓冲区
 	n, err := d.decoder.Decode(opusData, d.outBuffer)
 	if err != nil {
@@ -732,3 +736,122 @@ func PCMSlicesToOpusData(pcmSlices [][]byte, sampleRate int, channels int, bitra
 
 	return allOpusPackets, nil
 }
+
+// OpusEncoder 封装opus编码器，用于逐帧编码流式PCM数据
+type OpusEncoder struct {
+	encoder *opus.OpusEncoder
+	mu      sync.Mutex
+}
+
+// NewOpusEncoder 创建opus编码器，frameDuration为帧时长(毫秒)，支持20/40/60
+func NewOpusEncoder(sampleRate int, channels int, frameDuration int) (*OpusEncoder, error) {
+	frameSize := opus.Framesize60Ms
+	switch frameDuration {
+	case 20:
+		frameSize = opus.Framesize20Ms
+	case 40:
+		frameSize = opus.Framesize40Ms
+	}
+
+	encoder, err := opus.CreateOpusEncoder(&opus.OpusEncoderConfig{
+		SampleRate:    sampleRate,
+		MaxChannels:   channels,
+		Application:   opus.AppVoIP,
+		FrameDuration: frameSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建Opus编码器失败: %v", err)
+	}
+	return &OpusEncoder{encoder: encoder}, nil
+}
+
+// Encode 编码一帧PCM数据
+func (e *OpusEncoder) Encode(pcmData []byte) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.encoder == nil {
+		return nil, fmt.Errorf("Opus编码器已关闭")
+	}
+	outBuf := make([]byte, len(pcmData))
+	n, err := e.encoder.Encode(pcmData, outBuf)
+	if err != nil {
+		return nil, fmt.Errorf("Opus编码失败: %v", err)
+	}
+	return outBuf[:n], nil
+}
+
+// Close 关闭编码器
+func (e *OpusEncoder) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.encoder != nil {
+		if err := e.encoder.Close(); err != nil {
+			return fmt.Errorf("关闭Opus编码器失败: %v", err)
+		}
+		e.encoder = nil
+	}
+	return nil
+}
+
+// mp3PCMReader 边读取MP3数据边解码为16位单声道PCM
+type mp3PCMReader struct {
+	src     io.ReadCloser
+	decoder *mp3.Decoder
+	stereo  []byte // 解码得到的立体声数据，不足一个采样的部分留到下次读取
+}
+
+// NewMP3PCMReader 将MP3数据流转换为16位小端单声道PCM数据流，关闭时同时关闭src
+// 解码在读取时进行，无需等待MP3数据全部到达
+func NewMP3PCMReader(src io.ReadCloser) io.ReadCloser {
+	return &mp3PCMReader{src: src}
+}
+
+func (r *mp3PCMReader) Read(p []byte) (int, error) {
+	if r.decoder == nil {
+		decoder, err := mp3.NewDecoder(r.src)
+		if err != nil {
+			if err == io.EOF {
+				return 0, io.EOF
+			}
+			return 0, fmt.Errorf("创建MP3解码器失败: %v", err)
+		}
+		r.decoder = decoder
+	}
+
+	// 每4字节立体声采样输出2字节单声道采样
+	want := len(p) / 2 * 4
+	if want == 0 {
+		return 0, nil
+	}
+	for len(r.stereo) < 4 {
+		buf := make([]byte, want)
+		n, err := r.decoder.Read(buf)
+		r.stereo = append(r.stereo, buf[:n]...)
+		if err != nil {
+			if len(r.stereo) >= 4 {
+				break
+			}
+			return 0, err
+		}
+	}
+
+	samples := len(r.stereo) / 4
+	if samples > len(p)/2 {
+		samples = len(p) / 2
+	}
+	for i := 0; i < samples; i++ {
+		left := int16(uint16(r.stereo[i*4]) | uint16(r.stereo[i*4+1])<<8)
+		right := int16(uint16(r.stereo[i*4+2]) | uint16(r.stereo[i*4+3])<<8)
+		mono := int16((int32(left) + int32(right)) / 2)
+		p[i*2] = byte(mono)
+		p[i*2+1] = byte(mono >> 8)
+	}
+	r.stereo = r.stereo[samples*4:]
+	return samples * 2, nil
+}
+
+func (r *mp3PCMReader) Close() error {
+	return r.src.Close()
+}
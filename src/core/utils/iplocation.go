@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultIPLocationURL 默认的IP归属地查询接口，返回ip-api.com格式的JSON
+const DefaultIPLocationURL = "http://ip-api.com/json/{ip}?lang=zh-CN"
+
+// IsPublicIP 判断是否为公网IP，内网和本机地址无法查询归属地
+func IsPublicIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	return !parsed.IsLoopback() && !parsed.IsPrivate() && !parsed.IsLinkLocalUnicast() && !parsed.IsUnspecified()
+}
+
+// LookupIPLocation 查询IP归属地，apiURL中的{ip}替换为待查询的IP
+// 返回接口响应的JSON字段，如country、regionName、city、timezone
+func LookupIPLocation(ctx context.Context, apiURL, ip string) (map[string]interface{}, error) {
+	if apiURL == "" {
+		apiURL = DefaultIPLocationURL
+	}
+	reqURL := strings.ReplaceAll(apiURL, "{ip}", url.PathEscape(ip))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建IP归属地请求失败: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("查询IP归属地失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("查询IP归属地失败: HTTP %d", resp.StatusCode)
+	}
+
+	var info map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("解析IP归属地失败: %v", err)
+	}
+	if status, _ := info["status"].(string); status == "fail" {
+		return nil, fmt.Errorf("查询IP归属地失败: %v", info["message"])
+	}
+	return info, nil
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// pcmResampler 16位小端单声道PCM的流式重采样，使用线性插值
+type pcmResampler struct {
+	src      *bufio.Reader
+	from, to int
+	s0, s1   int16 // 当前输出位置两侧的输入样本
+	pos      int   // 输出位置在s0与s1之间的偏移，单位为1/to个输入样本
+	started  bool
+	err      error
+}
+
+// NewPCMResampler 将fromRate采样率的PCM流转换为toRate采样率
+func NewPCMResampler(r io.Reader, fromRate, toRate int) io.Reader {
+	return &pcmResampler{src: bufio.NewReader(r), from: fromRate, to: toRate}
+}
+
+func (r *pcmResampler) readSample() (int16, error) {
+	var b [2]byte
+	if _, err := io.ReadFull(r.src, b[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF // 丢弃末尾不完整的样本
+		}
+		return 0, err
+	}
+	return int16(binary.LittleEndian.Uint16(b[:])), nil
+}
+
+func (r *pcmResampler) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !r.started {
+		var err error
+		if r.s0, err = r.readSample(); err != nil {
+			r.err = err
+			return 0, err
+		}
+		if r.s1, err = r.readSample(); err != nil {
+			// 只有一个样本时原样输出
+			r.s1 = r.s0
+		}
+		r.started = true
+	}
+
+	n := 0
+	for n+2 <= len(p) {
+		for r.pos >= r.to {
+			sample, err := r.readSample()
+			if err != nil {
+				r.err = err
+				if n > 0 {
+					return n, nil
+				}
+				return 0, err
+			}
+			r.s0, r.s1 = r.s1, sample
+			r.pos -= r.to
+		}
+		v := int64(r.s0) + (int64(r.s1)-int64(r.s0))*int64(r.pos)/int64(r.to)
+		binary.LittleEndian.PutUint16(p[n:], uint16(int16(v)))
+		n += 2
+		r.pos += r.from
+	}
+	return n, nil
+}
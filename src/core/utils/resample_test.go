@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func pcmBytes(samples []int16) []byte {
+	buf := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(s))
+	}
+	return buf
+}
+
+func pcmSamples(data []byte) []int16 {
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	return samples
+}
+
+func TestPCMResampler(t *testing.T) {
+	ramp := make([]int16, 1600)
+	for i := range ramp {
+		ramp[i] = int16(i * 10)
+	}
+
+	tests := []struct {
+		name     string
+		from, to int
+	}{
+		{"16k升到24k", 16000, 24000},
+		{"22.05k升到24k", 22050, 24000},
+		{"48k降到24k", 48000, 24000},
+		{"采样率相同", 24000, 24000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := io.ReadAll(NewPCMResampler(bytes.NewReader(pcmBytes(ramp)), tt.from, tt.to))
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			samples := pcmSamples(out)
+
+			// 输出时长与输入一致，误差不超过一个样本
+			want := len(ramp) * tt.to / tt.from
+			if diff := len(samples) - want; diff < -1 || diff > 1 {
+				t.Errorf("输出%d个样本, want %d", len(samples), want)
+			}
+			// 线性插值后斜坡信号的每个样本都在对应输入位置上
+			for i, s := range samples {
+				expected := float64(i) * float64(tt.from) / float64(tt.to) * 10
+				if d := float64(s) - expected; d < -1 || d > 1 {
+					t.Fatalf("sample[%d] = %d, want %.1f", i, s, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestPCMResamplerSmallReads(t *testing.T) {
+	input := pcmBytes([]int16{0, 100, 200, 300, 400, 500, 600, 700})
+	want, _ := io.ReadAll(NewPCMResampler(bytes.NewReader(input), 16000, 24000))
+
+	r := NewPCMResampler(bytes.NewReader(input), 16000, 24000)
+	var got []byte
+	buf := make([]byte, 3) // 奇数长度的缓冲区每次只能输出一个样本
+	for {
+		n, err := r.Read(buf)
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("small reads = %v, want %v", pcmSamples(got), pcmSamples(want))
+	}
+}
+
+func TestPCMResamplerEmpty(t *testing.T) {
+	out, err := io.ReadAll(NewPCMResampler(bytes.NewReader(nil), 16000, 24000))
+	if err != nil || len(out) != 0 {
+		t.Errorf("ReadAll() = %v, %v, want empty", out, err)
+	}
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloadInterval 检查证书文件是否更新的间隔
+const certReloadInterval = 10 * time.Second
+
+// CertReloader 加载TLS证书，开启自动重载时证书文件更新后无需重启服务即可生效
+// 多个服务共用同一个实例，握手时通过GetCertificate取得当前证书
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	logger   *Logger
+
+	cert    *tls.Certificate
+	modTime time.Time // 已加载证书文件的修改时间
+	mu      sync.RWMutex
+}
+
+// NewCertReloader 创建证书加载器并立即加载证书
+func NewCertReloader(certFile, keyFile string, logger *Logger) (*CertReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("启用TLS需要配置cert_file和key_file")
+	}
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig 返回使用当前证书的TLS配置，最低版本为TLS 1.2
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// GetCertificate 返回当前证书
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch 定期检查证书和私钥文件，修改时间变化后重新加载，ctx结束后返回
+// 重新加载失败时继续使用原证书，证书续期工具分两次写入证书和私钥时会在下次检查时加载成功
+func (r *CertReloader) Watch(ctx context.Context) {
+	ticker := time.NewTicker(certReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modTime, err := r.latestModTime()
+			if err != nil {
+				r.logger.Warn(fmt.Sprintf("检查TLS证书文件失败: %v", err))
+				continue
+			}
+			r.mu.RLock()
+			changed := modTime.After(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.load(); err != nil {
+				r.logger.Error(fmt.Sprintf("重新加载TLS证书失败: %v", err))
+				continue
+			}
+			r.logger.Info(fmt.Sprintf("TLS证书已重新加载: %s", r.certFile))
+		}
+	}
+}
+
+// load 读取证书和私钥
+func (r *CertReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("加载TLS证书失败: %v", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// latestModTime 返回证书和私钥文件中较新的修改时间
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("读取证书文件失败: %v", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
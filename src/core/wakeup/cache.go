@@ -0,0 +1,117 @@
+package wakeup
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// Reply 已合成的问候语
+type Reply struct {
+	Text string
+	File string
+}
+
+// Cache 唤醒问候语音频缓存，服务启动时预先合成，所有会话共享
+// 音频文件以音色和文本的哈希命名，重启后可直接复用
+type Cache struct {
+	dir     string
+	logger  *utils.Logger
+	replies []Reply
+	mu      sync.RWMutex
+}
+
+// NewCache 创建问候语缓存
+func NewCache(dir string, logger *utils.Logger) *Cache {
+	return &Cache{dir: dir, logger: logger}
+}
+
+// Warmup 合成全部问候语，voice用于区分不同音色的缓存文件
+// 单条问候语合成失败不影响其他问候语
+func (c *Cache) Warmup(tts providers.TTSProvider, voice string, texts []string) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("创建问候语缓存目录失败: %v", err)
+	}
+
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		file, err := c.load(tts, voice, text)
+		if err != nil {
+			c.logger.Error(fmt.Sprintf("合成问候语失败: %s, %v", text, err))
+			continue
+		}
+		c.mu.Lock()
+		c.replies = append(c.replies, Reply{Text: text, File: file})
+		c.mu.Unlock()
+	}
+
+	c.logger.Info(fmt.Sprintf("唤醒问候语缓存完成，共%d条", c.Len()))
+	return nil
+}
+
+// load 返回问候语的缓存文件，不存在时调用TTS合成
+func (c *Cache) load(tts providers.TTSProvider, voice, text string) (string, error) {
+	sum := md5.Sum([]byte(voice + "|" + text))
+	pattern := filepath.Join(c.dir, hex.EncodeToString(sum[:])+".*")
+	if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+		return matches[0], nil
+	}
+
+	src, err := tts.ToTTS(text)
+	if err != nil {
+		return "", err
+	}
+	dst := filepath.Join(c.dir, hex.EncodeToString(sum[:])+filepath.Ext(src))
+	if err := moveFile(src, dst); err != nil {
+		return "", fmt.Errorf("写入问候语缓存失败: %v", err)
+	}
+	return dst, nil
+}
+
+// moveFile 将TTS输出的临时文件移动到缓存目录，跨文件系统时复制后删除源文件
+// 复制时先写入不匹配缓存文件名的临时文件，避免中途退出留下不完整的缓存
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(dst), ".tmp-"+filepath.Base(dst))
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// Random 随机返回一条已缓存的问候语
+func (c *Cache) Random() (Reply, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.replies) == 0 {
+		return Reply{}, false
+	}
+	return c.replies[rand.Intn(len(c.replies))], true
+}
+
+// Len 已缓存的问候语数量
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.replies)
+}
@@ -0,0 +1,116 @@
+package wakeup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// stubTTS 将文本写入输出目录中的临时文件，记录合成次数
+type stubTTS struct {
+	dir   string
+	calls map[string]int
+}
+
+func (s *stubTTS) Initialize() error { return nil }
+func (s *stubTTS) Cleanup() error    { return nil }
+
+func (s *stubTTS) ToTTS(text string) (string, error) {
+	s.calls[text]++
+	f, err := os.CreateTemp(s.dir, "tts_*.wav")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = f.WriteString(text)
+	return f.Name(), err
+}
+
+func newTestCache(t *testing.T, dir string) *Cache {
+	t.Helper()
+	config := &configs.Config{}
+	config.Log.LogDir = t.TempDir()
+	config.Log.LogFile = "test.log"
+	logger, err := utils.NewLogger(config)
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	return NewCache(dir, logger)
+}
+
+func TestWarmupCachesAndCleansUp(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "wakeup")
+	tts := &stubTTS{dir: t.TempDir(), calls: make(map[string]int)}
+	texts := []string{"我在", "", "你好呀"}
+
+	cache := newTestCache(t, cacheDir)
+	if err := cache.Warmup(tts, "voice", texts); err != nil {
+		t.Fatalf("Warmup() error = %v", err)
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", cache.Len())
+	}
+	for _, reply := range cache.replies {
+		data, err := os.ReadFile(reply.File)
+		if err != nil || string(data) != reply.Text {
+			t.Errorf("cached file %s = %q, %v, want %q", reply.File, data, err, reply.Text)
+		}
+		if filepath.Dir(reply.File) != cacheDir {
+			t.Errorf("cached file %s not in %s", reply.File, cacheDir)
+		}
+	}
+
+	// TTS输出目录中不能留下临时文件
+	if left, _ := os.ReadDir(tts.dir); len(left) != 0 {
+		t.Errorf("TTS输出目录残留%d个文件", len(left))
+	}
+
+	// 重新创建缓存时直接复用已有文件，同一音色不再合成
+	again := newTestCache(t, cacheDir)
+	if err := again.Warmup(tts, "voice", texts); err != nil {
+		t.Fatalf("Warmup() again error = %v", err)
+	}
+	for _, text := range []string{"我在", "你好呀"} {
+		if tts.calls[text] != 1 {
+			t.Errorf("ToTTS(%q) called %d times, want 1", text, tts.calls[text])
+		}
+	}
+
+	// 不同音色使用不同的缓存文件
+	other := newTestCache(t, cacheDir)
+	if err := other.Warmup(tts, "other-voice", []string{"我在"}); err != nil {
+		t.Fatalf("Warmup() other voice error = %v", err)
+	}
+	if tts.calls["我在"] != 2 {
+		t.Errorf("ToTTS() for another voice called %d times, want 2", tts.calls["我在"])
+	}
+	if entries, _ := os.ReadDir(cacheDir); len(entries) != 3 {
+		t.Errorf("cache dir has %d files, want 3", len(entries))
+	}
+}
+
+func TestRandomEmpty(t *testing.T) {
+	if _, ok := newTestCache(t, t.TempDir()).Random(); ok {
+		t.Error("Random() on empty cache ok = true")
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src.wav")
+	dst := filepath.Join(t.TempDir(), "dst.wav")
+	if err := os.WriteFile(src, []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveFile(src, dst); err != nil {
+		t.Fatalf("moveFile() error = %v", err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("source file still exists: %v", err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != "audio" {
+		t.Errorf("dst = %q, %v, want audio", data, err)
+	}
+}
@@ -2,16 +2,26 @@ package core
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/mcp"
+	"xiaozhi-server-go/src/core/pool"
 	"xiaozhi-server-go/src/core/providers"
-	"xiaozhi-server-go/src/core/providers/asr"
-	"xiaozhi-server-go/src/core/providers/llm"
-	"xiaozhi-server-go/src/core/providers/tts"
+	"xiaozhi-server-go/src/core/tools"
+	"xiaozhi-server-go/src/core/transport/mqtt"
 	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/core/wakeup"
+	"xiaozhi-server-go/src/device"
 	"xiaozhi-server-go/src/task"
 
 	"github.com/gorilla/websocket"
@@ -19,17 +29,21 @@ import (
 
 // WebSocketServer WebSocket服务器结构
 type WebSocketServer struct {
-	config    *configs.Config
-	server    *http.Server
-	upgrader  Upgrader
-	logger    *utils.Logger
-	taskMgr   *task.TaskManager
-	providers struct {
-		asr providers.ASRProvider
-		llm providers.LLMProvider
-		tts providers.TTSProvider
-	}
-	activeConnections sync.Map
+	config         *configs.Config
+	server         *http.Server
+	upgrader       Upgrader
+	logger         *utils.Logger
+	taskMgr        *task.TaskManager
+	poolManager    *pool.PoolManager
+	authManager    *auth.AuthManager
+	activation     *device.ActivationManager
+	sessionManager *SessionManager
+	mqttGateway    *mqtt.Gateway
+	mcpManager     *mcp.Manager
+	wakeupCache    *wakeup.Cache
+	tlsConfig      *tls.Config   // 非nil时以wss提供服务
+	stopped        chan struct{} // Stop后关闭
+	stopOnce       sync.Once
 }
 
 // Upgrader WebSocket升级器接口
@@ -44,12 +58,24 @@ type Conn interface {
 	Close() error
 }
 
+// TransportConn 非WebSocket传输的连接，在hello消息中附加传输参数
+type TransportConn interface {
+	Conn
+	TransportType() string
+	HelloParams() map[string]interface{}
+}
+
 // NewWebSocketServer 创建新的WebSocket服务器
-func NewWebSocketServer(config *configs.Config, logger *utils.Logger) (*WebSocketServer, error) {
+func NewWebSocketServer(config *configs.Config, logger *utils.Logger, activation *device.ActivationManager, authManager *auth.AuthManager) (*WebSocketServer, error) {
+	pingInterval := time.Duration(config.Server.Keepalive.PingInterval) * time.Second
+	readTimeout := time.Duration(config.Server.Keepalive.ReadTimeout) * time.Second
 	ws := &WebSocketServer{
-		config:   config,
-		logger:   logger,
-		upgrader: NewDefaultUpgrader(),
+		config:      config,
+		logger:      logger,
+		upgrader:    NewDefaultUpgrader(pingInterval, readTimeout, config.Server.AllowedOrigins),
+		activation:  activation,
+		authManager: authManager,
+		stopped:     make(chan struct{}),
 		taskMgr: func() *task.TaskManager {
 			tm := task.NewTaskManager(task.ResourceConfig{
 				MaxWorkers:          12,
@@ -63,45 +89,114 @@ func NewWebSocketServer(config *configs.Config, logger *utils.Logger) (*WebSocke
 		}(),
 	}
 
-	// 初始化处理模块实例
-	if err := ws.initializeProviders(); err != nil {
+	// 提前检查配置中启用的工具是否存在
+	if _, err := tools.Resolve(config.Tools.Enabled); err != nil {
+		return nil, err
+	}
+	if err := validateAgents(config); err != nil {
+		return nil, err
+	}
+
+	// 初始化服务提供者资源池
+	poolManager, err := pool.NewPoolManager(config, logger)
+	if err != nil {
 		return nil, fmt.Errorf("初始化处理模块失败: %v", err)
 	}
+	ws.poolManager = poolManager
+	ws.sessionManager = NewSessionManager(logger, ws.taskMgr)
+	if activation != nil {
+		activation.OnUnbind(func(deviceID string) {
+			if n := ws.sessionManager.CloseDevice(deviceID); n > 0 {
+				logger.Info(fmt.Sprintf("设备%s已解绑，断开%d个会话", deviceID, n))
+			}
+		})
+	}
+	ws.mcpManager = mcp.NewManager(config, logger)
+	if config.Wakeup.QuickReply {
+		cacheDir := config.Wakeup.CacheDir
+		if cacheDir == "" {
+			cacheDir = defaultWakeupCacheDir
+		}
+		ws.wakeupCache = wakeup.NewCache(cacheDir, logger)
+	}
 
 	return ws, nil
 }
 
 // Start 启动WebSocket服务器
 func (ws *WebSocketServer) Start(ctx context.Context) error {
-	// 检查providers是否已初始化
-	if ws.providers.asr == nil || ws.providers.llm == nil || ws.providers.tts == nil {
+	// 检查资源池是否已初始化
+	if ws.poolManager == nil {
 		ws.logger.Error("必要的服务提供者未初始化")
 		return fmt.Errorf("必要的服务提供者未初始化")
 	}
 
-	addr := fmt.Sprintf("%s:%d", ws.config.Server.IP, ws.config.Server.Port)
+	// 后台连接外部MCP服务，连接完成后新会话即可使用其工具
+	go ws.mcpManager.Start(ctx)
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", ws.handleWebSocket)
-
-	ws.server = &http.Server{
-		Addr:    addr,
-		Handler: mux,
+	// 后台预先合成唤醒问候语
+	if ws.wakeupCache != nil {
+		go ws.warmupWakeupReplies()
 	}
 
-	ws.logger.Info(fmt.Sprintf("正在启动WebSocket服务器于 ws://%s...", addr))
+	// 启动MQTT+UDP接入网关
+	if ws.config.MQTT.Enabled {
+		ws.mqttGateway = mqtt.NewGateway(ws.config, ws.logger,
+			func(deviceID, token string) error {
+				return ws.authManager.Authenticate(token, deviceID)
+			},
+			func(c *mqtt.Conn) {
+				ws.startSession(c, c.DeviceID(), c.ClientID(), c.RemoteIP())
+			})
+		if err := ws.mqttGateway.Start(); err != nil {
+			ws.logger.Error(fmt.Sprintf("MQTT网关启动失败: %v", err))
+			return fmt.Errorf("MQTT网关启动失败: %v", err)
+		}
+	}
 
 	// 启动服务器关闭监控
 	go func() {
-		<-ctx.Done()
+		select {
+		case <-ctx.Done():
+		case <-ws.stopped:
+			return
+		}
 		ws.logger.Info("收到关闭信号，准备关闭服务器...")
 		if err := ws.Stop(); err != nil {
 			ws.logger.Error(fmt.Sprintf("服务器关闭时出错: %v", err))
 		}
 	}()
 
-	// 启动服务器
-	if err := ws.server.ListenAndServe(); err != nil {
+	// WebSocket挂载到Web服务时不单独监听，等待服务关闭
+	if ws.config.Server.Unified {
+		ws.logger.Info(fmt.Sprintf("WebSocket服务已挂载到Web服务，路径: %s", ws.Path()))
+		<-ws.stopped
+		return nil
+	}
+
+	addr := fmt.Sprintf("%s:%d", ws.config.Server.IP, ws.config.Server.Port)
+	mux := http.NewServeMux()
+	mux.HandleFunc(ws.Path(), ws.HandleWebSocket)
+	ws.server = &http.Server{
+		Addr:      addr,
+		Handler:   mux,
+		TLSConfig: ws.tlsConfig,
+	}
+
+	scheme := "ws"
+	if ws.tlsConfig != nil {
+		scheme = "wss"
+	}
+	ws.logger.Info(fmt.Sprintf("正在启动WebSocket服务器于 %s://%s%s...", scheme, addr, ws.Path()))
+
+	// 启动服务器，证书由TLSConfig提供
+	var err error
+	if ws.tlsConfig != nil {
+		err = ws.server.ListenAndServeTLS("", "")
+	} else {
+		err = ws.server.ListenAndServe()
+	}
+	if err != nil {
 		if err == http.ErrServerClosed {
 			ws.logger.Info("服务器已正常关闭")
 			return nil
@@ -113,204 +208,319 @@ func (ws *WebSocketServer) Start(ctx context.Context) error {
 	return nil
 }
 
+const (
+	// pingWriteTimeout 发送ping的写超时
+	pingWriteTimeout = 10 * time.Second
+	// defaultWakeupCacheDir 唤醒问候语默认缓存目录
+	defaultWakeupCacheDir = "tmp/wakeup"
+	// defaultWebSocketPath 默认的WebSocket接入路径，单独监听时接受任意路径，与旧版本保持一致
+	defaultWebSocketPath = "/"
+)
+
+// SetTLSConfig 设置TLS配置，需在Start之前调用
+func (ws *WebSocketServer) SetTLSConfig(tlsConfig *tls.Config) {
+	ws.tlsConfig = tlsConfig
+}
+
+// Path 返回WebSocket接入路径
+func (ws *WebSocketServer) Path() string {
+	path := ws.config.Server.WebSocketPath
+	if path == "" {
+		return defaultWebSocketPath
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
 // defaultUpgrader 默认的WebSocket升级器实现
 type defaultUpgrader struct {
-	wsUpgrader *websocket.Upgrader
+	wsUpgrader   *websocket.Upgrader
+	pingInterval time.Duration // 心跳间隔，0表示不发送ping
+	readTimeout  time.Duration // 读取超时，0表示不限制
 }
 
 // NewDefaultUpgrader 创建默认的WebSocket升级器
-func NewDefaultUpgrader() *defaultUpgrader {
+// allowedOrigins 为允许的网页来源，为空时只允许同源网页，包含"*"时允许所有来源
+func NewDefaultUpgrader(pingInterval, readTimeout time.Duration, allowedOrigins []string) *defaultUpgrader {
 	return &defaultUpgrader{
 		wsUpgrader: &websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // 允许所有来源的连接
-			},
+			CheckOrigin: newOriginChecker(allowedOrigins),
 		},
+		pingInterval: pingInterval,
+		readTimeout:  readTimeout,
+	}
+}
+
+// newOriginChecker 创建来源检查函数
+// 设备等非浏览器客户端不携带Origin请求头，始终允许连接
+func newOriginChecker(allowedOrigins []string) func(r *http.Request) bool {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowed["*"] || allowed[strings.ToLower(origin)] {
+			return true
+		}
+		// 同源网页，如Web服务提供的管理页面
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
 	}
 }
 
 // websocketConn 封装gorilla/websocket的连接实现
+// 定时发送ping，收到任何消息或pong后延长读取超时，对端异常断开时ReadMessage会超时返回
 type websocketConn struct {
-	conn *websocket.Conn
+	conn        *websocket.Conn
+	readTimeout time.Duration
+	done        chan struct{}
+	closeOnce   sync.Once
 }
 
 func (w *websocketConn) ReadMessage() (messageType int, p []byte, err error) {
-	return w.conn.ReadMessage()
+	messageType, p, err = w.conn.ReadMessage()
+	if err == nil {
+		w.extendReadDeadline()
+	}
+	return messageType, p, err
 }
 
 func (w *websocketConn) WriteMessage(messageType int, data []byte) error {
 	return w.conn.WriteMessage(messageType, data)
 }
 
+// SetWriteDeadline 设置写入超时
+func (w *websocketConn) SetWriteDeadline(t time.Time) error {
+	return w.conn.SetWriteDeadline(t)
+}
+
 func (w *websocketConn) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
 	return w.conn.Close()
 }
 
+// extendReadDeadline 延长读取超时
+func (w *websocketConn) extendReadDeadline() error {
+	if w.readTimeout <= 0 {
+		return nil
+	}
+	return w.conn.SetReadDeadline(time.Now().Add(w.readTimeout))
+}
+
+// keepalive 定时发送ping，WriteControl可与其他写操作并发调用
+func (w *websocketConn) keepalive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			if err := w.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(pingWriteTimeout)); err != nil {
+				// 连接已不可写，由读取超时或读取错误结束会话
+				return
+			}
+		}
+	}
+}
+
 // Upgrade 实现Upgrader接口
 func (u *defaultUpgrader) Upgrade(w http.ResponseWriter, r *http.Request) (Conn, error) {
 	conn, err := u.wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return nil, err
 	}
-	return &websocketConn{conn: conn}, nil
+
+	wc := &websocketConn{
+		conn:        conn,
+		readTimeout: u.readTimeout,
+		done:        make(chan struct{}),
+	}
+	wc.extendReadDeadline()
+	conn.SetPongHandler(func(string) error {
+		return wc.extendReadDeadline()
+	})
+	conn.SetPingHandler(func(data string) error {
+		// 设备发起的心跳同样视为连接存活，回复失败时由读取超时处理
+		wc.extendReadDeadline()
+		conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(pingWriteTimeout))
+		return nil
+	})
+	if u.pingInterval > 0 {
+		go wc.keepalive(u.pingInterval)
+	}
+	return wc, nil
 }
 
 // Stop 停止WebSocket服务器
+// 可重复调用，只有第一次调用会执行关闭
 func (ws *WebSocketServer) Stop() error {
-	if ws.server != nil {
-		ws.logger.Info("正在关闭WebSocket服务器...")
+	var err error
+	ws.stopOnce.Do(func() {
+		close(ws.stopped)
+		err = ws.stop()
+	})
+	return err
+}
 
-		// 关闭所有活动连接
-		ws.activeConnections.Range(func(key, value interface{}) bool {
-			if conn, ok := value.(Conn); ok {
-				conn.Close()
-			}
-			return true
-		})
+func (ws *WebSocketServer) stop() error {
+	ws.logger.Info("正在关闭WebSocket服务器...")
+
+	// 关闭所有活动会话
+	ws.sessionManager.CloseAll()
 
-		// 关闭服务器
+	// 关闭服务器
+	if ws.server != nil {
 		if err := ws.server.Close(); err != nil {
 			return fmt.Errorf("服务器关闭失败: %v", err)
 		}
 	}
+
+	if ws.mqttGateway != nil {
+		if err := ws.mqttGateway.Stop(); err != nil {
+			ws.logger.Error(fmt.Sprintf("关闭MQTT网关失败: %v", err))
+		}
+	}
+
+	ws.mcpManager.Close()
+
+	// 释放资源池中的服务提供者
+	if ws.poolManager != nil {
+		if err := ws.poolManager.Close(); err != nil {
+			ws.logger.Error(fmt.Sprintf("关闭资源池失败: %v", err))
+		}
+	}
 	return nil
 }
 
-// handleWebSocket 处理WebSocket连接
-func (ws *WebSocketServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+// HandleWebSocket 处理WebSocket连接，WebSocket挂载到Web服务时由Gin路由调用
+func (ws *WebSocketServer) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	deviceID := getRequestValue(r, "Device-Id", "device-id")
+	clientID := getRequestValue(r, "Client-Id", "client-id")
+	clientIP := getClientIP(r)
+
+	// 升级前完成握手认证，认证失败直接返回HTTP错误
+	// token只从请求头读取，放在URL中会被记录到访问日志
+	token := auth.ParseBearerToken(r.Header.Get("Authorization"))
+	if err := ws.authManager.Authenticate(token, deviceID); err != nil {
+		ws.logger.Warn(fmt.Sprintf("设备认证失败: %v, 设备: %s, IP: %s", err, deviceID, clientIP))
+		status := http.StatusUnauthorized
+		switch {
+		case errors.Is(err, auth.ErrMissingDeviceID):
+			status = http.StatusBadRequest
+		case errors.Is(err, auth.ErrDeviceMismatch):
+			status = http.StatusForbidden
+		default:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="xiaozhi"`)
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
 	conn, err := ws.upgrader.Upgrade(w, r)
 	if err != nil {
 		ws.logger.Error(fmt.Sprintf("WebSocket升级失败: %v", err))
 		return
 	}
 
-	clientID := fmt.Sprintf("%p", conn)
-	ws.activeConnections.Store(clientID, conn)
+	ws.startSession(conn, deviceID, clientID, clientIP)
+}
+
+// startSession 为新连接分配服务提供者并启动连接处理，WebSocket和MQTT连接共用
+func (ws *WebSocketServer) startSession(conn Conn, deviceID, clientID, clientIP string) {
+	// 按设备使用的智能体为当前连接获取独立的服务提供者实例
+	agentName, agent := resolveAgent(ws.config, deviceID)
+	providerSet, err := ws.poolManager.GetProviderSet(agent.LLM, agent.TTS, agent.Voice)
+	if err != nil {
+		ws.logger.Error(fmt.Sprintf("获取服务提供者失败: %v", err))
+		conn.Close()
+		return
+	}
 
 	// 创建新的连接处理器
 	handler := NewConnectionHandler(ws.config, struct {
 		asr providers.ASRProvider
 		llm providers.LLMProvider
 		tts providers.TTSProvider
+		vad providers.VADProvider
 	}{
-		asr: ws.providers.asr,
-		llm: ws.providers.llm,
-		tts: ws.providers.tts,
+		asr: providerSet.ASR,
+		llm: providerSet.LLM,
+		tts: providerSet.TTS,
+		vad: providerSet.VAD,
 	}, ws.logger)
 
 	// Initialize task manager for the handler
 	handler.taskMgr = ws.taskMgr
-	go handler.Handle(conn)
-}
-
-// initializeProviders 初始化所有提供者
-func (ws *WebSocketServer) initializeProviders() error {
-	ws.logger.Info("开始初始化服务提供者...")
-	selectedModule := ws.config.SelectedModule
-
-	// 检查必要的模块配置是否存在
-	requiredModules := []string{"ASR", "LLM", "TTS"}
-	for _, module := range requiredModules {
-		if _, ok := selectedModule[module]; !ok {
-			err := fmt.Sprintf("配置文件中缺少必要的模块配置: %s", module)
-			ws.logger.Error(err)
-			return fmt.Errorf(err)
-		}
+	handler.activation = ws.activation
+	// 问候语缓存按默认音色合成，智能体使用其他音色时不使用
+	if agent.TTS == "" && agent.Voice == "" {
+		handler.wakeup = ws.wakeupCache
 	}
-
-	// 初始化ASR
-	asrType, ok := selectedModule["ASR"]
-	if !ok {
-		ws.logger.Error("未找到ASR配置")
-		return fmt.Errorf("未找到ASR配置")
-	}
-
-	if asrType != "" {
-		ws.logger.Info(fmt.Sprintf("正在初始化ASR服务(%s)...", asrType))
-		if asrCfg, ok := ws.config.ASR[asrType]; ok {
-			asrType, _ := asrCfg["type"].(string)
-			provider, err := asr.Create(asrType, &asr.Config{
-				Type: asrType,
-				Data: asrCfg,
-			}, ws.config.DeleteAudio)
-			if err != nil {
-				ws.logger.Error(fmt.Sprintf("初始化ASR失败: %v", err))
-				return fmt.Errorf("初始化ASR失败: %v", err)
-			}
-			ws.providers.asr = provider.(providers.ASRProvider)
-			ws.logger.Info("ASR服务初始化成功")
-		} else {
-			ws.logger.Error(fmt.Sprintf("找不到ASR配置: %s", asrType))
-		}
+	handler.isDeviceVerified = ws.activation.IsActivated(deviceID)
+	for _, tool := range ws.mcpManager.Tools() {
+		handler.RegisterFunction(tool)
 	}
 
-	// 初始化LLM
-	llmType, ok := selectedModule["LLM"]
-	if !ok {
-		ws.logger.Error("未找到LLM配置")
-		return fmt.Errorf("未找到LLM配置")
-	}
-
-	if llmType != "" {
-		ws.logger.Info(fmt.Sprintf("正在初始化LLM服务(%s)...", llmType))
-		if llmCfg, ok := ws.config.LLM[llmType]; ok {
-			provider, err := llm.Create(llmCfg.Type, &llm.Config{
-				Type:        llmCfg.Type,
-				ModelName:   llmCfg.ModelName,
-				BaseURL:     llmCfg.BaseURL,
-				APIKey:      llmCfg.APIKey,
-				Temperature: llmCfg.Temperature,
-				MaxTokens:   llmCfg.MaxTokens,
-				TopP:        llmCfg.TopP,
-				Extra:       llmCfg.Extra,
-			})
-			if err != nil {
-				ws.logger.Error(fmt.Sprintf("初始化LLM失败: %v", err))
-				return fmt.Errorf("初始化LLM失败: %v", err)
-			}
-			ws.providers.llm = provider.(providers.LLMProvider)
-			ws.logger.Info("LLM服务初始化成功")
-		} else {
-			ws.logger.Error(fmt.Sprintf("找不到LLM配置: %s", llmType))
-		}
+	// 登记会话
+	session := ws.sessionManager.CreateSession(deviceID, clientID, clientIP, conn, handler)
+	handler.sessionID = session.ID
+	handler.clientIP = clientIP
+	handler.headers = map[string]string{
+		"device-id": deviceID,
+		"client-id": clientID,
 	}
+	handler.applyAgent(agentName, agent)
 
-	// 初始化TTS
-	ttsType, ok := selectedModule["TTS"]
-	if !ok {
-		ws.logger.Error("未找到TTS配置")
-		return fmt.Errorf("未找到TTS配置")
-	}
-
-	if ttsType != "" {
-		ws.logger.Info(fmt.Sprintf("正在初始化TTS服务(%s)...", ttsType))
-		if ttsCfg, ok := ws.config.TTS[ttsType]; ok {
-			provider, err := tts.Create(ttsCfg.Type, &tts.Config{
-				Type:      ttsCfg.Type,
-				Voice:     ttsCfg.Voice,
-				Format:    ttsCfg.Format,
-				OutputDir: ttsCfg.OutputDir,
-				AppID:     ttsCfg.AppID,
-				Token:     ttsCfg.Token,
-				Cluster:   ttsCfg.Cluster,
-			}, ws.config.DeleteAudio)
-			if err != nil {
-				ws.logger.Error(fmt.Sprintf("初始化TTS失败: %v", err))
-				return fmt.Errorf("初始化TTS失败: %v", err)
-			}
-			ws.providers.tts = provider.(providers.TTSProvider)
-			ws.logger.Info("TTS服务初始化成功")
-		} else {
-			ws.logger.Error(fmt.Sprintf("找不到TTS配置: %s", ttsType))
+	go func() {
+		handler.Handle(conn)
+		// 会话结束，清理会话并归还服务提供者
+		ws.sessionManager.RemoveSession(session.ID)
+		if err := ws.poolManager.ReturnProviderSet(providerSet); err != nil {
+			ws.logger.Error(fmt.Sprintf("归还服务提供者失败: %v", err))
 		}
+	}()
+}
+
+// warmupWakeupReplies 借用一个TTS实例合成唤醒问候语
+func (ws *WebSocketServer) warmupWakeupReplies() {
+	ttsName := ws.config.SelectedModule["TTS"]
+	ttsCfg := ws.config.TTS[ttsName]
+	voice := fmt.Sprintf("%s|%s|%s", ttsName, ttsCfg.Type, ttsCfg.Voice)
+	err := ws.poolManager.WithTTS(func(tts providers.TTSProvider) error {
+		return ws.wakeupCache.Warmup(tts, voice, ws.config.Wakeup.Replies)
+	})
+	if err != nil {
+		ws.logger.Error(fmt.Sprintf("合成唤醒问候语失败: %v", err))
 	}
+}
 
-	// 最终检查所有必需的provider是否都已初始化
-	if ws.providers.asr == nil || ws.providers.llm == nil || ws.providers.tts == nil {
-		ws.logger.Error("一个或多个必需的服务提供者初始化失败")
-		return fmt.Errorf("一个或多个必需的服务提供者初始化失败")
+// getRequestValue 优先从请求头读取，缺失时从URL查询参数读取（浏览器客户端无法自定义请求头）
+func getRequestValue(r *http.Request, header string, query string) string {
+	if value := r.Header.Get(header); value != "" {
+		return value
 	}
+	return r.URL.Query().Get(query)
+}
 
-	ws.logger.Info("所有服务提供者初始化成功完成")
-	return nil
+// getClientIP 获取客户端真实IP
+func getClientIP(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
@@ -0,0 +1,26 @@
+package core
+
+import (
+	"testing"
+
+	"xiaozhi-server-go/src/configs"
+)
+
+func TestWebSocketServerPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", "/"},
+		{"/xiaozhi/v1/", "/xiaozhi/v1/"},
+		{"xiaozhi/v1/", "/xiaozhi/v1/"},
+	}
+	for _, tt := range tests {
+		config := &configs.Config{}
+		config.Server.WebSocketPath = tt.path
+		ws := &WebSocketServer{config: config}
+		if got := ws.Path(); got != tt.want {
+			t.Errorf("Path() with websocket_path %q = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package device
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+)
+
+const (
+	defaultCodeTTL  = 5 * time.Minute
+	defaultDataFile = "data/devices.json"
+)
+
+// activationCode 待确认的激活码
+type activationCode struct {
+	code      string
+	deviceID  string
+	expiresAt time.Time
+}
+
+// ActivationManager 设备激活管理器
+// 未绑定的设备会获得一个六位激活码，管理员在后台确认激活码后设备即与账号绑定
+type ActivationManager struct {
+	enabled bool
+	ttl     time.Duration
+	store   *Store
+
+	codes    map[string]*activationCode // 激活码 -> 激活信息
+	byDevice map[string]*activationCode // 设备ID -> 激活信息
+	onUnbind []func(deviceID string)
+	mu       sync.Mutex
+}
+
+// NewActivationManager 根据配置创建激活管理器
+func NewActivationManager(config *configs.Config) (*ActivationManager, error) {
+	cfg := config.Server.Activation
+	// 未配置token时任何人都能通过管理接口绑定设备，激活形同虚设
+	if cfg.Enabled && cfg.AdminToken == "" {
+		return nil, fmt.Errorf("启用设备激活时必须配置admin_token")
+	}
+
+	dataFile := cfg.DataFile
+	if dataFile == "" {
+		dataFile = defaultDataFile
+	}
+	store, err := NewStore(dataFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := time.Duration(cfg.CodeTTL) * time.Second
+	if ttl <= 0 {
+		ttl = defaultCodeTTL
+	}
+
+	return &ActivationManager{
+		enabled:  cfg.Enabled,
+		ttl:      ttl,
+		store:    store,
+		codes:    make(map[string]*activationCode),
+		byDevice: make(map[string]*activationCode),
+	}, nil
+}
+
+// Enabled 是否启用设备激活
+func (m *ActivationManager) Enabled() bool {
+	return m.enabled
+}
+
+// Store 返回已绑定设备存储
+func (m *ActivationManager) Store() *Store {
+	return m.store
+}
+
+// IsActivated 判断设备是否已激活，未启用激活时所有设备都视为已激活
+func (m *ActivationManager) IsActivated(deviceID string) bool {
+	if !m.enabled {
+		return true
+	}
+	return deviceID != "" && m.store.IsBound(deviceID)
+}
+
+// GetOrCreateCode 获取设备当前有效的激活码，没有则生成新的激活码
+func (m *ActivationManager) GetOrCreateCode(deviceID string) (string, time.Time, error) {
+	if deviceID == "" {
+		return "", time.Time{}, fmt.Errorf("缺少设备ID")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeExpired()
+	if ac, ok := m.byDevice[deviceID]; ok {
+		return ac.code, ac.expiresAt, nil
+	}
+
+	code, err := m.newCode()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	ac := &activationCode{
+		code:      code,
+		deviceID:  deviceID,
+		expiresAt: time.Now().Add(m.ttl),
+	}
+	m.codes[code] = ac
+	m.byDevice[deviceID] = ac
+	return ac.code, ac.expiresAt, nil
+}
+
+// Activate 确认激活码，将对应设备绑定到账号
+func (m *ActivationManager) Activate(code, accountID, alias string) (*BoundDevice, error) {
+	if accountID == "" {
+		return nil, fmt.Errorf("缺少账号ID")
+	}
+
+	m.mu.Lock()
+	m.removeExpired()
+	ac, ok := m.codes[code]
+	if ok {
+		delete(m.codes, code)
+		delete(m.byDevice, ac.deviceID)
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("激活码无效或已过期")
+	}
+
+	device := &BoundDevice{
+		DeviceID:  ac.deviceID,
+		AccountID: accountID,
+		Alias:     alias,
+		BoundAt:   time.Now(),
+	}
+	if err := m.store.Bind(device); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// Unbind 解绑设备，解绑后设备需要重新激活
+// 解绑成功后通知OnUnbind注册的回调，由其断开该设备已建立的会话
+func (m *ActivationManager) Unbind(deviceID string) error {
+	if err := m.store.Unbind(deviceID); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	hooks := append([]func(string){}, m.onUnbind...)
+	m.mu.Unlock()
+	for _, fn := range hooks {
+		fn(deviceID)
+	}
+	return nil
+}
+
+// OnUnbind 注册设备解绑回调
+func (m *ActivationManager) OnUnbind(fn func(deviceID string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onUnbind = append(m.onUnbind, fn)
+}
+
+// removeExpired 清理过期的激活码，调用方需持有锁
+func (m *ActivationManager) removeExpired() {
+	now := time.Now()
+	for code, ac := range m.codes {
+		if now.After(ac.expiresAt) {
+			delete(m.codes, code)
+			delete(m.byDevice, ac.deviceID)
+		}
+	}
+}
+
+// newCode 生成不与现有激活码重复的六位数字，调用方需持有锁
+func (m *ActivationManager) newCode() (string, error) {
+	for i := 0; i < 10; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+		if err != nil {
+			return "", fmt.Errorf("生成激活码失败: %v", err)
+		}
+		code := fmt.Sprintf("%06d", n.Int64())
+		if _, exists := m.codes[code]; !exists {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("生成激活码失败: 重试次数过多")
+}
@@ -0,0 +1,175 @@
+package device
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+)
+
+func newTestActivationManager(t *testing.T) *ActivationManager {
+	t.Helper()
+	config := &configs.Config{}
+	config.Server.Activation.Enabled = true
+	config.Server.Activation.AdminToken = "admin"
+	config.Server.Activation.DataFile = filepath.Join(t.TempDir(), "devices.json")
+	m, err := NewActivationManager(config)
+	if err != nil {
+		t.Fatalf("NewActivationManager() error = %v", err)
+	}
+	return m
+}
+
+func TestNewActivationManagerRequiresAdminToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		adminToken string
+		wantErr    bool
+	}{
+		{"启用且配置token", true, "admin", false},
+		{"启用但未配置token", true, "", true},
+		{"未启用", false, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &configs.Config{}
+			config.Server.Activation.Enabled = tt.enabled
+			config.Server.Activation.AdminToken = tt.adminToken
+			config.Server.Activation.DataFile = filepath.Join(t.TempDir(), "devices.json")
+			_, err := NewActivationManager(config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewActivationManager() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetOrCreateCode(t *testing.T) {
+	m := newTestActivationManager(t)
+
+	code, expiresAt, err := m.GetOrCreateCode("device-a")
+	if err != nil {
+		t.Fatalf("GetOrCreateCode() error = %v", err)
+	}
+	if !regexp.MustCompile(`^\d{6}$`).MatchString(code) {
+		t.Errorf("GetOrCreateCode() code = %q, want six digits", code)
+	}
+	if !expiresAt.After(time.Now()) {
+		t.Errorf("GetOrCreateCode() expiresAt = %v, want in the future", expiresAt)
+	}
+
+	again, _, err := m.GetOrCreateCode("device-a")
+	if err != nil || again != code {
+		t.Errorf("GetOrCreateCode() again = %q, %v, want %q", again, err, code)
+	}
+	other, _, err := m.GetOrCreateCode("device-b")
+	if err != nil || other == code {
+		t.Errorf("GetOrCreateCode() for another device = %q, %v, want a different code", other, err)
+	}
+
+	if _, _, err := m.GetOrCreateCode(""); err == nil {
+		t.Error("GetOrCreateCode(\"\") should fail")
+	}
+}
+
+func TestGetOrCreateCodeExpired(t *testing.T) {
+	m := newTestActivationManager(t)
+	code, _, _ := m.GetOrCreateCode("device-a")
+	m.byDevice["device-a"].expiresAt = time.Now().Add(-time.Second)
+
+	if _, err := m.Activate(code, "account", ""); err == nil {
+		t.Error("Activate() with expired code should fail")
+	}
+	if _, _, err := m.GetOrCreateCode("device-a"); err != nil {
+		t.Errorf("GetOrCreateCode() after expiry error = %v", err)
+	}
+}
+
+func TestActivate(t *testing.T) {
+	m := newTestActivationManager(t)
+	if m.IsActivated("device-a") {
+		t.Fatal("IsActivated() before activation = true")
+	}
+
+	code, _, _ := m.GetOrCreateCode("device-a")
+	tests := []struct {
+		name      string
+		code      string
+		accountID string
+		wantErr   bool
+	}{
+		{"缺少账号", code, "", true},
+		{"错误的激活码", "not-a-code", "account", true},
+		{"激活成功", code, "account", false},
+		{"激活码只能使用一次", code, "account", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device, err := m.Activate(tt.code, tt.accountID, "客厅")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Activate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (device.DeviceID != "device-a" || device.AccountID != "account" || device.Alias != "客厅") {
+				t.Errorf("Activate() = %+v", device)
+			}
+		})
+	}
+
+	if !m.IsActivated("device-a") {
+		t.Error("IsActivated() after activation = false")
+	}
+	if m.IsActivated("device-b") {
+		t.Error("IsActivated() for unbound device = true")
+	}
+
+	// 绑定关系写入文件，重新加载后仍然有效
+	reloaded, err := NewStore(m.store.path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	if !reloaded.IsBound("device-a") {
+		t.Error("bound device not persisted")
+	}
+
+	if err := m.Unbind("device-a"); err != nil {
+		t.Fatalf("Unbind() error = %v", err)
+	}
+	if m.IsActivated("device-a") {
+		t.Error("IsActivated() after unbind = true")
+	}
+}
+
+func TestIsActivatedDisabled(t *testing.T) {
+	config := &configs.Config{}
+	config.Server.Activation.DataFile = filepath.Join(t.TempDir(), "devices.json")
+	m, err := NewActivationManager(config)
+	if err != nil {
+		t.Fatalf("NewActivationManager() error = %v", err)
+	}
+	if !m.IsActivated("any-device") {
+		t.Error("IsActivated() with activation disabled = false")
+	}
+}
+
+func TestUnbindNotifiesHooks(t *testing.T) {
+	m := newTestActivationManager(t)
+	var unbound []string
+	m.OnUnbind(func(deviceID string) { unbound = append(unbound, deviceID) })
+
+	code, _, _ := m.GetOrCreateCode("device-a")
+	if _, err := m.Activate(code, "account", ""); err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+	if err := m.Unbind("device-b"); err == nil {
+		t.Error("Unbind() for unbound device should fail")
+	}
+	if err := m.Unbind("device-a"); err != nil {
+		t.Fatalf("Unbind() error = %v", err)
+	}
+	if len(unbound) != 1 || unbound[0] != "device-a" {
+		t.Errorf("OnUnbind hooks called with %v, want [device-a]", unbound)
+	}
+}
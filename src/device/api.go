@@ -0,0 +1,84 @@
+package device
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"xiaozhi-server-go/src/core/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminService 设备管理接口
+type AdminService struct {
+	manager    *ActivationManager
+	auth       *auth.AuthManager
+	adminToken string
+}
+
+// NewAdminService 构造函数，adminToken为空时拒绝所有请求，调用方应只在配置了token时注册路由
+func NewAdminService(manager *ActivationManager, authManager *auth.AuthManager, adminToken string) *AdminService {
+	return &AdminService{manager: manager, auth: authManager, adminToken: adminToken}
+}
+
+// Start 注册设备管理相关路由
+func (s *AdminService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	group := apiGroup.Group("/admin/devices", s.authMiddleware)
+
+	// 已绑定设备列表
+	group.GET("", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": s.manager.Store().List()})
+	})
+
+	// 确认激活码并绑定设备
+	group.POST("/activate", func(c *gin.Context) {
+		var req struct {
+			Code      string `json:"code"`
+			AccountID string `json:"account_id"`
+			Alias     string `json:"alias"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "解析失败: " + err.Error()})
+			return
+		}
+		device, err := s.manager.Activate(strings.TrimSpace(req.Code), req.AccountID, req.Alias)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": device})
+	})
+
+	// 为设备签发连接token，用于无法通过OTA获取token的设备
+	group.POST("/:device_id/token", func(c *gin.Context) {
+		token, err := s.auth.GenerateToken(c.Param("device_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"token": token}})
+	})
+
+	// 解绑设备
+	group.DELETE("/:device_id", func(c *gin.Context) {
+		if err := s.manager.Unbind(c.Param("device_id")); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	})
+
+	return nil
+}
+
+// authMiddleware 校验管理员token
+func (s *AdminService) authMiddleware(c *gin.Context) {
+	token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if s.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "message": "未授权"})
+		return
+	}
+	c.Next()
+}
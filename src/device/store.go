@@ -0,0 +1,142 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BoundDevice 已绑定的设备
+type BoundDevice struct {
+	DeviceID  string    `json:"device_id"`
+	AccountID string    `json:"account_id"`
+	Alias     string    `json:"alias,omitempty"`
+	BoundAt   time.Time `json:"bound_at"`
+}
+
+// Store 已绑定设备的持久化存储，数据以JSON格式保存在本地文件中
+type Store struct {
+	path    string
+	devices map[string]*BoundDevice
+	mu      sync.RWMutex
+}
+
+// NewStore 创建存储并加载已有数据
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		devices: make(map[string]*BoundDevice),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load 从文件加载已绑定设备，文件不存在时视为空
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取设备数据失败: %v", err)
+	}
+
+	var devices []*BoundDevice
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return fmt.Errorf("解析设备数据失败: %v", err)
+	}
+	for _, d := range devices {
+		s.devices[d.DeviceID] = d
+	}
+	return nil
+}
+
+// save 将已绑定设备写入文件，调用方需持有锁
+func (s *Store) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("创建数据目录失败: %v", err)
+	}
+
+	data, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化设备数据失败: %v", err)
+	}
+
+	// 先写临时文件再重命名，避免写入中途退出导致文件损坏
+	tmpFile := s.path + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return fmt.Errorf("写入设备数据失败: %v", err)
+	}
+	if err := os.Rename(tmpFile, s.path); err != nil {
+		return fmt.Errorf("保存设备数据失败: %v", err)
+	}
+	return nil
+}
+
+// Get 获取已绑定设备
+func (s *Store) Get(deviceID string) (*BoundDevice, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.devices[deviceID]
+	return d, ok
+}
+
+// IsBound 判断设备是否已绑定
+func (s *Store) IsBound(deviceID string) bool {
+	_, ok := s.Get(deviceID)
+	return ok
+}
+
+// Bind 绑定设备到账号
+func (s *Store) Bind(device *BoundDevice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.devices[device.DeviceID] = device
+	if err := s.save(); err != nil {
+		delete(s.devices, device.DeviceID)
+		return err
+	}
+	return nil
+}
+
+// Unbind 解绑设备
+func (s *Store) Unbind(deviceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	device, ok := s.devices[deviceID]
+	if !ok {
+		return fmt.Errorf("设备未绑定: %s", deviceID)
+	}
+	delete(s.devices, deviceID)
+	if err := s.save(); err != nil {
+		s.devices[deviceID] = device
+		return err
+	}
+	return nil
+}
+
+// List 按绑定时间列出所有已绑定设备
+func (s *Store) List() []*BoundDevice {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list()
+}
+
+func (s *Store) list() []*BoundDevice {
+	devices := make([]*BoundDevice, 0, len(s.devices))
+	for _, d := range s.devices {
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].BoundAt.Before(devices[j].BoundAt)
+	})
+	return devices
+}
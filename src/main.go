@@ -2,17 +2,21 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"xiaozhi-server-go/src/configs"
 	"xiaozhi-server-go/src/core"
+	"xiaozhi-server-go/src/core/auth"
 	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/device"
 	"xiaozhi-server-go/src/ota"
 
 	"strconv"
@@ -26,6 +30,7 @@ import (
 	_ "xiaozhi-server-go/src/core/providers/llm/openai"
 	_ "xiaozhi-server-go/src/core/providers/tts/doubao"
 	_ "xiaozhi-server-go/src/core/providers/tts/edge"
+	_ "xiaozhi-server-go/src/core/providers/vad/energy"
 )
 
 func main() {
@@ -42,13 +47,40 @@ func main() {
 	}
 	logger.Info(fmt.Sprintf("日志系统初始化成功, 配置文件路径: %s", configPath))
 
+	// 初始化设备激活管理
+	activation, err := device.NewActivationManager(config)
+	if err != nil {
+		logger.Error("初始化设备激活管理失败", err)
+		os.Exit(1)
+	}
+
+	// 设备认证，WebSocket/MQTT握手校验和OTA签发token共用
+	authManager := auth.NewAuthManager(config)
+
 	// 创建 WebSocket 服务
-	wsServer, err := core.NewWebSocketServer(config, logger)
+	wsServer, err := core.NewWebSocketServer(config, logger, activation, authManager)
 	if err != nil {
 		logger.Error("创建 WebSocket 服务器失败", err)
 		os.Exit(1)
 	}
 
+	// 启用TLS时WebSocket和Web服务共用同一份证书
+	var tlsConfig *tls.Config
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if config.Server.TLS.Enabled {
+		certReloader, err := utils.NewCertReloader(config.Server.TLS.CertFile, config.Server.TLS.KeyFile, logger)
+		if err != nil {
+			logger.Error("初始化TLS证书失败", err)
+			os.Exit(1)
+		}
+		if config.Server.TLS.AutoReload {
+			go certReloader.Watch(watchCtx)
+		}
+		tlsConfig = certReloader.TLSConfig()
+		wsServer.SetTLSConfig(tlsConfig)
+	}
+
 	// 初始化Gin引擎
 	if config.Log.LogLevel == "debug" {
 		gin.SetMode(gin.DebugMode)
@@ -60,33 +92,75 @@ func main() {
 
 	// API路由全部挂载到/api前缀下
 	apiGroup := router.Group("/api")
-	otaUpdateURL := "ws://localhost:" + strconv.Itoa(config.Web.Port) + "/ws"
-	otaService := ota.NewDefaultOTAService(otaUpdateURL)
+	otaService := ota.NewDefaultOTAService(config.Server.PublicURL, activation, authManager)
+	otaService.WebSocketPath = wsServer.Path()
+	otaService.Secure = tlsConfig != nil
+	if !config.Server.Unified {
+		otaService.WebSocketPort = config.Server.Port
+	}
+	if config.MQTT.Enabled {
+		otaService.MQTTEndpoint = config.MQTT.PublicEndpoint
+		if otaService.MQTTEndpoint == "" {
+			otaService.MQTTEndpoint = fmt.Sprintf("%s:%d", utils.GetLocalIP(), config.MQTT.Port)
+		}
+	}
 	if err := otaService.Start(context.Background(), router, apiGroup); err != nil {
 		logger.Error("OTA 服务启动失败", err)
 		os.Exit(1)
 	}
 
+	// 设备管理接口，未配置admin_token时不开放
+	if adminToken := config.Server.Activation.AdminToken; adminToken != "" {
+		deviceService := device.NewAdminService(activation, authManager, adminToken)
+		if err := deviceService.Start(context.Background(), router, apiGroup); err != nil {
+			logger.Error("设备管理服务启动失败", err)
+			os.Exit(1)
+		}
+	} else {
+		logger.Warn("未配置admin_token，设备管理接口未启用")
+	}
+
+	// WebSocket与HTTP接口共用端口
+	if config.Server.Unified {
+		for _, path := range websocketRoutes(wsServer.Path()) {
+			router.GET(path, gin.WrapF(wsServer.HandleWebSocket))
+		}
+	}
+
 	// 前端页面
-	router.Static("/admin", filepath.Join("web", "dist"))
+	if config.Web.Enabled {
+		staticDir := config.Web.StaticDir
+		if staticDir == "" {
+			staticDir = filepath.Join("web", "dist")
+		}
+		router.Static("/admin", staticDir)
 
-	// 未匹配的所有路由，返回前端 index.html
-	router.NoRoute(func(c *gin.Context) {
-		c.File(filepath.Join("web", "dist", "index.html"))
-	})
+		// 未匹配的所有路由，返回前端 index.html
+		router.NoRoute(func(c *gin.Context) {
+			c.File(filepath.Join(staticDir, "index.html"))
+		})
+	}
 
 	// 用 errgroup 管理两个服务
 	g, ctx := errgroup.WithContext(context.Background())
 
 	// HTTP Server（支持优雅关机）
 	httpServer := &http.Server{
-		Addr:    ":" + strconv.Itoa(config.Web.Port),
-		Handler: router,
+		Addr:      ":" + strconv.Itoa(config.Web.Port),
+		Handler:   router,
+		TLSConfig: tlsConfig,
 	}
 	g.Go(func() error {
-		logger.Info(fmt.Sprintf("Gin 服务已启动，访问地址: http://localhost:%d", config.Web.Port))
+		var err error
+		if tlsConfig != nil {
+			logger.Info(fmt.Sprintf("Gin 服务已启动，访问地址: https://localhost:%d", config.Web.Port))
+			err = httpServer.ListenAndServeTLS("", "")
+		} else {
+			logger.Info(fmt.Sprintf("Gin 服务已启动，访问地址: http://localhost:%d", config.Web.Port))
+			err = httpServer.ListenAndServe()
+		}
 		// ListenAndServe 返回 ErrServerClosed 时表示正常关闭
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err != nil && err != http.ErrServerClosed {
 			logger.Error("HTTP 服务启动失败", err)
 			return err
 		}
@@ -139,3 +213,13 @@ func main() {
 	logger.Info("所有服务已成功关闭，程序退出")
 	// logger.Close()
 }
+
+// websocketRoutes 返回WebSocket路径的路由，带与不带结尾斜杠的路径都注册
+// WebSocket客户端不会跟随Gin对结尾斜杠的重定向
+func websocketRoutes(path string) []string {
+	trimmed := strings.TrimSuffix(path, "/")
+	if trimmed == "" {
+		return []string{path}
+	}
+	return []string{trimmed, trimmed + "/"}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWebsocketRoutes(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/xiaozhi/v1/", []string{"/xiaozhi/v1", "/xiaozhi/v1/"}},
+		{"/xiaozhi/v1", []string{"/xiaozhi/v1", "/xiaozhi/v1/"}},
+		{"/", []string{"/"}},
+	}
+	for _, tt := range tests {
+		if got := websocketRoutes(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("websocketRoutes(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
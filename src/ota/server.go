@@ -2,23 +2,92 @@ package ota
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/transport/mqtt"
+	"xiaozhi-server-go/src/device"
+
 	"github.com/gin-gonic/gin"
 )
 
 type DefaultOTAService struct {
+	// UpdateURL 下发给设备的WebSocket地址，为空时根据请求计算
 	UpdateURL string
+	// WebSocketPath WebSocket接入路径
+	WebSocketPath string
+	// WebSocketPort WebSocket单独监听的端口，0表示与OTA接口共用端口
+	WebSocketPort int
+	// Secure 服务端启用了TLS，下发wss地址
+	Secure bool
+	// MQTTEndpoint 非空时向设备下发MQTT接入配置(host:port)
+	MQTTEndpoint string
+	activation   *device.ActivationManager
+	auth         *auth.AuthManager
 }
 
 // NewDefaultOTAService 构造函数
-func NewDefaultOTAService(updateURL string) *DefaultOTAService {
-	return &DefaultOTAService{UpdateURL: updateURL}
+func NewDefaultOTAService(updateURL string, activation *device.ActivationManager, authManager *auth.AuthManager) *DefaultOTAService {
+	return &DefaultOTAService{UpdateURL: updateURL, activation: activation, auth: authManager}
+}
+
+// deviceToken 返回下发给设备的连接凭证，未启用认证或请求未携带有效token时为空
+// OTA接口本身不做认证，只为已持有有效token的设备续签，首次签发需通过设备管理接口
+func (s *DefaultOTAService) deviceToken(r *http.Request, deviceID string) string {
+	if s.auth == nil || !s.auth.Enabled() {
+		return ""
+	}
+	token := auth.ParseBearerToken(r.Header.Get("Authorization"))
+	if s.auth.CheckToken(token, deviceID) != nil {
+		return ""
+	}
+	if s.activation != nil && !s.activation.IsActivated(deviceID) {
+		return token
+	}
+	// 续签以延长有效期，未配置secret_key时原样返回
+	if renewed, err := s.auth.GenerateToken(deviceID); err == nil {
+		return renewed
+	}
+	return token
+}
+
+// websocketURL 返回下发给设备的WebSocket地址
+// 未配置固定地址时，协议和主机取自请求的X-Forwarded-Proto/X-Forwarded-Host请求头或Host，经反向代理访问时同样适用
+func (s *DefaultOTAService) websocketURL(r *http.Request) string {
+	if s.UpdateURL != "" {
+		return s.UpdateURL
+	}
+
+	scheme := "ws"
+	if s.Secure || r.TLS != nil || strings.EqualFold(firstHeaderValue(r, "X-Forwarded-Proto"), "https") {
+		scheme = "wss"
+	}
+	host := firstHeaderValue(r, "X-Forwarded-Host")
+	if host == "" {
+		host = r.Host
+	}
+	if s.WebSocketPort > 0 {
+		// WebSocket单独监听时替换为WebSocket端口
+		hostname := host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			hostname = h
+		}
+		host = net.JoinHostPort(strings.Trim(hostname, "[]"), strconv.Itoa(s.WebSocketPort))
+	}
+	return scheme + "://" + host + s.WebSocketPath
+}
+
+// firstHeaderValue 返回请求头的第一个值，多级代理时X-Forwarded-*为逗号分隔的列表
+func firstHeaderValue(r *http.Request, key string) string {
+	value, _, _ := strings.Cut(r.Header.Get(key), ",")
+	return strings.TrimSpace(value)
 }
 
 // Start 实现 OTAService 接口，注册所有 OTA 相关路由
@@ -33,7 +102,7 @@ func (s *DefaultOTAService) Start(ctx context.Context, engine *gin.Engine, apiGr
 		case http.MethodOptions:
 			c.Status(http.StatusOK)
 		case http.MethodGet:
-			c.String(http.StatusOK, "OTA interface is running, websocket address: "+s.UpdateURL)
+			c.String(http.StatusOK, "OTA interface is running, websocket address: "+s.websocketURL(c.Request))
 		case http.MethodPost:
 			deviceID := c.GetHeader("device-id")
 			if deviceID == "" {
@@ -68,7 +137,7 @@ func (s *DefaultOTAService) Start(ctx context.Context, engine *gin.Engine, apiGr
 				firmwareURL = "/ota_bin/" + latest
 			}
 
-			c.JSON(http.StatusOK, gin.H{
+			resp := gin.H{
 				"server_time": gin.H{
 					"timestamp":       time.Now().UnixNano() / 1e6,
 					"timezone_offset": 8 * 60,
@@ -78,9 +147,41 @@ func (s *DefaultOTAService) Start(ctx context.Context, engine *gin.Engine, apiGr
 					"url":     firmwareURL,
 				},
 				"websocket": gin.H{
-					"url": s.UpdateURL,
+					"url":   s.websocketURL(c.Request),
+					"token": s.deviceToken(c.Request, deviceID),
 				},
-			})
+			}
+
+			// 启用MQTT时下发MQTT接入配置，设备优先使用MQTT+UDP连接
+			if s.MQTTEndpoint != "" {
+				clientID := c.GetHeader("client-id")
+				if clientID == "" {
+					clientID = deviceID
+				}
+				resp["mqtt"] = gin.H{
+					"endpoint":        s.MQTTEndpoint,
+					"client_id":       mqtt.ClientIDForDevice(deviceID, clientID),
+					"username":        deviceID,
+					"password":        s.deviceToken(c.Request, deviceID),
+					"publish_topic":   mqtt.PublishTopic,
+					"subscribe_topic": mqtt.DeviceTopic(deviceID),
+				}
+			}
+
+			// 未绑定的设备下发激活码
+			if s.activation != nil && !s.activation.IsActivated(deviceID) {
+				code, _, err := s.activation.GetOrCreateCode(deviceID)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+					return
+				}
+				resp["activation"] = gin.H{
+					"code":    code,
+					"message": "请在控制面板输入验证码\n" + code,
+				}
+			}
+
+			c.JSON(http.StatusOK, resp)
 		default:
 			c.String(http.StatusMethodNotAllowed, "不支持的方法: %s", c.Request.Method)
 		}
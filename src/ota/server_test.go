@@ -0,0 +1,125 @@
+package ota
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/device"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testDeviceID = "aa:bb:cc:dd:ee:ff"
+
+// newTestOTAService 创建启用认证和激活的OTA服务，testDeviceID已绑定
+func newTestOTAService(t *testing.T) (*gin.Engine, *auth.AuthManager) {
+	t.Helper()
+	// OTA接口会在当前目录下创建ota_bin目录
+	t.Chdir(t.TempDir())
+
+	config := &configs.Config{}
+	config.Server.Auth.Enabled = true
+	config.Server.Auth.SecretKey = "secret"
+	config.Server.Auth.Tokens = []configs.TokenConfig{{Token: "static-token"}}
+	config.Server.Auth.AllowedDevices = []string{"11:22:33:44:55:66"}
+	config.Server.Activation.Enabled = true
+	config.Server.Activation.AdminToken = "admin"
+	config.Server.Activation.DataFile = filepath.Join(t.TempDir(), "devices.json")
+
+	activation, err := device.NewActivationManager(config)
+	if err != nil {
+		t.Fatalf("NewActivationManager() error = %v", err)
+	}
+	code, _, err := activation.GetOrCreateCode(testDeviceID)
+	if err != nil {
+		t.Fatalf("GetOrCreateCode() error = %v", err)
+	}
+	if _, err := activation.Activate(code, "account", ""); err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+
+	authManager := auth.NewAuthManager(config)
+	service := NewDefaultOTAService("", activation, authManager)
+	service.MQTTEndpoint = "127.0.0.1:1883"
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	if err := service.Start(context.Background(), engine, engine.Group("/xiaozhi")); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	return engine, authManager
+}
+
+// requestOTA 发送OTA请求，返回下发的websocket token和mqtt密码
+func requestOTA(t *testing.T, engine *gin.Engine, deviceID, authorization string) (string, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/xiaozhi/ota/", strings.NewReader(`{"application":{"version":"1.0.0"}}`))
+	req.Header.Set("Device-Id", deviceID)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("OTA status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		WebSocket struct {
+			Token string `json:"token"`
+		} `json:"websocket"`
+		MQTT struct {
+			Password string `json:"password"`
+		} `json:"mqtt"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析OTA响应失败: %v", err)
+	}
+	return resp.WebSocket.Token, resp.MQTT.Password
+}
+
+func TestOTATokenRequiresAuthorization(t *testing.T) {
+	engine, authManager := newTestOTAService(t)
+	otherToken, _ := authManager.GenerateToken("66:55:44:33:22:11")
+
+	tests := []struct {
+		name          string
+		deviceID      string
+		authorization string
+	}{
+		{"已绑定设备未携带token", testDeviceID, ""},
+		{"无效token", testDeviceID, "Bearer invalid"},
+		{"其他设备的token", testDeviceID, "Bearer " + otherToken},
+		{"白名单设备不签发token", "11:22:33:44:55:66", "Bearer anything"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, password := requestOTA(t, engine, tt.deviceID, tt.authorization)
+			if token != "" || password != "" {
+				t.Errorf("OTA returned token %q, password %q, want none", token, password)
+			}
+		})
+	}
+}
+
+func TestOTATokenRenewal(t *testing.T) {
+	engine, authManager := newTestOTAService(t)
+	deviceToken, _ := authManager.GenerateToken(testDeviceID)
+
+	for _, authorization := range []string{"Bearer " + deviceToken, "Bearer static-token"} {
+		token, password := requestOTA(t, engine, testDeviceID, authorization)
+		if token == "" || token != password {
+			t.Fatalf("OTA with %q returned token %q, password %q", authorization, token, password)
+		}
+		if deviceID, err := authManager.VerifyToken(token); err != nil || deviceID != testDeviceID {
+			t.Errorf("VerifyToken(renewed) = %q, %v, want %q", deviceID, err, testDeviceID)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package task
 
 import (
+	"context"
 	"encoding/json"
 	"xiaozhi-server-go/src/core/interfaces"
 )
@@ -49,13 +50,13 @@ func NewVoiceCallback(conn interfaces.ConnectionHandler) *VoiceCallback {
 func (vc *VoiceCallback) OnComplete(result interface{}) {
 	// Convert result to text and use speakAndPlay
 	if text, ok := result.(string); ok {
-		vc.conn.SpeakAndPlay(text, 0)
+		vc.conn.SpeakAndPlay(context.Background(), text, 0)
 	}
 }
 
 func (vc *VoiceCallback) OnError(err error) {
 	// Speak error message
-	vc.conn.SpeakAndPlay("任务执行失败: "+err.Error(), 0)
+	vc.conn.SpeakAndPlay(context.Background(), "任务执行失败: "+err.Error(), 0)
 }
 
 // ActionCallback implements TaskCallback for custom actions
@@ -44,6 +44,11 @@ func (tm *TaskManager) SubmitTask(clientID string, task *Task) error {
 	return tm.submitImmediateTask(clientID, task)
 }
 
+// RemoveClient releases the context and quotas held for a disconnected client
+func (tm *TaskManager) RemoveClient(clientID string) {
+	tm.clientManager.RemoveClient(clientID)
+}
+
 // submitImmediateTask submits a task for immediate execution
 func (tm *TaskManager) submitImmediateTask(clientID string, task *Task) error {
 	// Get or create client context